@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// maximum IAM role path length
+	maxRolePathLength = 512
+)
+
+var (
+	// AWS partitions and, for the non-standard ones, the default region of their regional STS endpoint
+	awsPartitions = map[string]string{
+		"aws":        "",
+		"aws-cn":     "cn-north-1",
+		"aws-us-gov": "us-gov-west-1",
+	}
+	// region name prefixes of the non-standard AWS partitions
+	awsPartitionRegionPrefixes = map[string]string{
+		"aws-cn":     "cn-",
+		"aws-us-gov": "us-gov-",
+	}
+
+	accountIDPattern    = regexp.MustCompile(`^[0-9]{12}$`)
+	roleNamePattern     = regexp.MustCompile(`^[\w+=,.@-]{1,64}$`)
+	rolePathPartPattern = regexp.MustCompile(`^[\x21-\x2E\x30-\x7E]+$`)
+)
+
+// roleARN is a parsed IAM role ARN: arn:<partition>:iam::<account>:role<path><name>.
+type roleARN struct {
+	Partition string
+	AccountID string
+	Path      string // starts and ends with '/'
+	Name      string
+}
+
+// parseRoleArn parses and validates an IAM role ARN, e.g. arn:aws:iam::123456789012:role/path/name.
+func parseRoleArn(s string) (*roleARN, error) {
+	parts := strings.SplitN(s, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" {
+		return nil, fmt.Errorf("invalid role ARN %q: expected arn:<partition>:iam::<account>:role/<name>", s)
+	}
+	a := &roleARN{Partition: parts[1], AccountID: parts[4], Path: "/"}
+	if _, ok := awsPartitions[a.Partition]; !ok {
+		return nil, fmt.Errorf("invalid role ARN %q: unknown partition %q", s, a.Partition)
+	}
+	if parts[2] != "iam" || parts[3] != "" {
+		return nil, fmt.Errorf("invalid role ARN %q: not an IAM ARN", s)
+	}
+	if !accountIDPattern.MatchString(a.AccountID) {
+		return nil, fmt.Errorf("invalid role ARN %q: account ID %q is not 12 digits", s, a.AccountID)
+	}
+	resource, ok := strings.CutPrefix(parts[5], "role/")
+	if !ok {
+		return nil, fmt.Errorf("invalid role ARN %q: not a role", s)
+	}
+	segments := strings.Split(resource, "/")
+	a.Name = segments[len(segments)-1]
+	if !roleNamePattern.MatchString(a.Name) {
+		return nil, fmt.Errorf("invalid role ARN %q: invalid role name %q", s, a.Name)
+	}
+	for _, part := range segments[:len(segments)-1] {
+		if !rolePathPartPattern.MatchString(part) {
+			return nil, fmt.Errorf("invalid role ARN %q: invalid role path", s)
+		}
+		a.Path += part + "/"
+	}
+	if len(a.Path) > maxRolePathLength {
+		return nil, fmt.Errorf("invalid role ARN %q: role path longer than %d characters", s, maxRolePathLength)
+	}
+	return a, nil
+}
+
+// String returns the role ARN.
+func (a *roleARN) String() string {
+	return fmt.Sprintf("arn:%s:iam::%s:role%s%s", a.Partition, a.AccountID, a.Path, a.Name)
+}
+
+// roleName returns the role name, prefixed with its path, if any (e.g. path/name).
+func (a *roleARN) roleName() string {
+	return strings.TrimPrefix(a.Path, "/") + a.Name
+}
+
+// partitionRegion returns the default region of the role ARN partition regional STS endpoint,
+// or an empty string for the standard partition, served by the global STS endpoint.
+func (a *roleARN) partitionRegion() string {
+	return awsPartitions[a.Partition]
+}
+
+// inPartition reports whether the region belongs to the role ARN partition.
+func (a *roleARN) inPartition(region string) bool {
+	if prefix, ok := awsPartitionRegionPrefixes[a.Partition]; ok {
+		return strings.HasPrefix(region, prefix)
+	}
+	for _, prefix := range awsPartitionRegionPrefixes {
+		if strings.HasPrefix(region, prefix) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+//nolint:funlen
+func Test_parseRoleArn(t *testing.T) {
+	tests := []struct {
+		arn     string
+		want    *roleARN
+		wantErr bool
+	}{
+		{
+			arn:  "arn:aws:iam::123456789012:role/testrole",
+			want: &roleARN{Partition: "aws", AccountID: "123456789012", Path: "/", Name: "testrole"},
+		},
+		{
+			arn:  "arn:aws-cn:iam::123456789012:role/team/app/reader",
+			want: &roleARN{Partition: "aws-cn", AccountID: "123456789012", Path: "/team/app/", Name: "reader"},
+		},
+		{
+			arn:  "arn:aws-us-gov:iam::123456789012:role/my_role+=,.@-1",
+			want: &roleARN{Partition: "aws-us-gov", AccountID: "123456789012", Path: "/", Name: "my_role+=,.@-1"},
+		},
+		{arn: "testrole", wantErr: true},
+		{arn: "arn:aws-eu:iam::123456789012:role/testrole", wantErr: true},
+		{arn: "arn:aws:sts::123456789012:role/testrole", wantErr: true},
+		{arn: "arn:aws:iam:us-east-1:123456789012:role/testrole", wantErr: true},
+		{arn: "arn:aws:iam::12345678901:role/testrole", wantErr: true},
+		{arn: "arn:aws:iam::12345678901a:role/testrole", wantErr: true},
+		{arn: "arn:aws:iam::123456789012:user/testrole", wantErr: true},
+		{arn: "arn:aws:iam::123456789012:role/", wantErr: true},
+		{arn: "arn:aws:iam::123456789012:role/test role", wantErr: true},
+		{arn: "arn:aws:iam::123456789012:role/team//testrole", wantErr: true},
+		{arn: "arn:aws:iam::123456789012:role/" + string(make([]byte, 65)), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arn, func(t *testing.T) {
+			got, err := parseRoleArn(tt.arn)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRoleArn() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !cmp.Equal(got, tt.want) {
+				t.Errorf("parseRoleArn() diff %v", cmp.Diff(tt.want, got))
+			}
+			if got != nil && got.String() != tt.arn {
+				t.Errorf("roleARN.String() = %q, want %q", got.String(), tt.arn)
+			}
+		})
+	}
+}
+
+func Test_mutatingWebhook_mutatePod_regionalEnv(t *testing.T) {
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+		Name: "test-sa", Namespace: "test-namespace",
+		Annotations: map[string]string{awsRoleArnKey: "arn:aws-cn:iam::123456789012:role/testrole"},
+	}}
+	mw := &mutatingWebhook{
+		k8sClient:  fake.NewSimpleClientset(sa, testNamespace("test-namespace")),
+		volumeName: tokenVolumeName,
+		volumePath: tokenVolumePath,
+		tokenFile:  tokenFileName,
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Labels: enabledLabels()},
+		Spec: corev1.PodSpec{
+			ServiceAccountName: "test-sa",
+			Containers: []corev1.Container{
+				{Name: "app"},
+				{Name: "other", Env: []corev1.EnvVar{{Name: awsRegion, Value: "cn-northwest-1"}}},
+			},
+		},
+	}
+	if _, err := mw.mutatePod(context.TODO(), pod, "test-namespace", false); err != nil {
+		t.Fatalf("mutatingWebhook.mutatePod() unexpected error = %v", err)
+	}
+	for name, wantRegion := range map[string]string{"app": "cn-north-1", "other": "cn-northwest-1"} {
+		env := map[string]string{}
+		for _, v := range pod.Spec.Containers[findContainer(pod.Spec.Containers, name)].Env {
+			env[v.Name] = v.Value
+		}
+		if env[awsRegion] != wantRegion || env[awsStsRegionalEndpoints] != awsStsRegionalEndpointsReg {
+			t.Errorf("container %q regional env = %v", name, env)
+		}
+	}
+}
+
+func Test_mutatingWebhook_mutatePod_invalidRoleArn(t *testing.T) {
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+		Name: "test-sa", Namespace: "test-namespace",
+		Annotations: map[string]string{awsRoleArnKey: "arn:aws:iam::1234:role/testrole"},
+	}}
+	mw := &mutatingWebhook{
+		k8sClient: fake.NewSimpleClientset(sa, testNamespace("test-namespace")),
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Labels: enabledLabels()},
+		Spec:       corev1.PodSpec{ServiceAccountName: "test-sa", Containers: []corev1.Container{{Name: "app"}}},
+	}
+	if _, err := mw.mutatePod(context.TODO(), pod, "test-namespace", false); err == nil {
+		t.Fatal("mutatingWebhook.mutatePod() expected error")
+	}
+}
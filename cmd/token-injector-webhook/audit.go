@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// annotations recording on the pod what the webhook did
+const (
+	webhookVersionKey    = "token-injector.io/webhook-version"
+	injectorImageKey     = "token-injector.io/injector-image"
+	roleArnSourceKey     = "token-injector.io/role-arn-source"
+	mutatedContainersKey = "token-injector.io/mutated-containers"
+	configHashKey        = "token-injector.io/config-hash"
+)
+
+// appliedConfig is the configuration applied to an injected pod, identified by its hash.
+type appliedConfig struct {
+	RoleArn    string             `json:"roleArn"`
+	Env        []corev1.EnvVar    `json:"env,omitempty"`
+	Containers []corev1.Container `json:"containers"`
+	Volume     corev1.Volume      `json:"volume"`
+}
+
+// hash returns the hex encoded SHA-256 of the configuration.
+func (c *appliedConfig) hash() (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// mutatedContainers returns the names of the pod init containers and containers selected for the injection.
+func mutatedContainers(pod *corev1.Pod, sel containerSelector) []string {
+	var names []string
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, c := range containers {
+			if !isInjectorContainer(c.Name) && sel.selected(c.Name) {
+				names = append(names, c.Name)
+			}
+		}
+	}
+	return names
+}
+
+// auditInjection annotates the injected pod with the webhook version, the injector image, the role ARN
+// source, the mutated containers and the applied configuration hash.
+func auditInjection(pod *corev1.Pod, image, roleSource string, containers []string, configHash string) {
+	setAnnotation(pod, webhookVersionKey, Version)
+	setAnnotation(pod, injectorImageKey, image)
+	setAnnotation(pod, roleArnSourceKey, roleSource)
+	setAnnotation(pod, mutatedContainersKey, strings.Join(containers, ","))
+	setAnnotation(pod, configHashKey, configHash)
+}
+
+// auditSkip annotates the skipped pod with the webhook version, and removes the injection audit annotations.
+func auditSkip(pod *corev1.Pod) {
+	setAnnotation(pod, webhookVersionKey, Version)
+	for _, key := range []string{injectorImageKey, roleArnSourceKey, mutatedContainersKey, configHashKey} {
+		delete(pod.Annotations, key)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_appliedConfig_hash(t *testing.T) {
+	config := func(roleArn string) *appliedConfig {
+		return &appliedConfig{
+			RoleArn:    roleArn,
+			Containers: []corev1.Container{{Name: injectorSidecarContainerName, Image: "token-injector:test"}},
+			Volume:     getInjectorVolume(tokenVolumeName),
+		}
+	}
+	hash, err := config(testRoleArn).hash()
+	if err != nil {
+		t.Fatalf("appliedConfig.hash() unexpected error = %v", err)
+	}
+	if again, _ := config(testRoleArn).hash(); again != hash {
+		t.Errorf("appliedConfig.hash() = %q, want stable %q", again, hash)
+	}
+	if other, _ := config("arn:aws:iam::123456789012:role/other").hash(); other == hash {
+		t.Errorf("appliedConfig.hash() same hash for a different configuration")
+	}
+}
+
+//nolint:funlen
+func Test_mutatingWebhook_mutatePod_audit(t *testing.T) {
+	tests := []struct {
+		name           string
+		podAnnotations map[string]string
+		selection      string
+		want           map[string]string
+	}{
+		{
+			name: "injected from the service account",
+			want: map[string]string{
+				injectionStatusKey:   injectionStatusInjected,
+				webhookVersionKey:    Version,
+				injectorImageKey:     "token-injector:test",
+				roleArnSourceKey:     roleSourceServiceAccount,
+				mutatedContainersKey: "migrate,app,worker",
+			},
+		},
+		{
+			name:           "injected from the pod, selected containers",
+			podAnnotations: map[string]string{awsRoleArnKey: testRoleArn, containersKey: "app"},
+			want: map[string]string{
+				awsRoleArnKey:        testRoleArn,
+				containersKey:        "app",
+				injectionStatusKey:   injectionStatusInjected,
+				webhookVersionKey:    Version,
+				injectorImageKey:     "token-injector:test",
+				roleArnSourceKey:     roleSourcePod,
+				mutatedContainersKey: "app",
+			},
+		},
+		{
+			name:           "skipped",
+			podAnnotations: map[string]string{injectKey: "false", injectorImageKey: "stale", configHashKey: "stale"},
+			want: map[string]string{
+				injectKey:          "false",
+				injectionStatusKey: injectionStatusSkipped,
+				skipReasonKey:      skipReasonPodOptOut,
+				webhookVersionKey:  Version,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+				Name: "test-sa", Namespace: "test-namespace", Annotations: map[string]string{awsRoleArnKey: testRoleArn},
+			}}
+			ns := testNamespace("test-namespace")
+			ns.Annotations = map[string]string{allowedRoleArnsKey: testRoleArn}
+			mw := &mutatingWebhook{
+				k8sClient:  fake.NewSimpleClientset(sa, ns),
+				image:      "token-injector:test",
+				volumeName: tokenVolumeName,
+				volumePath: tokenVolumePath,
+				tokenFile:  tokenFileName,
+			}
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Labels: enabledLabels(), Annotations: tt.podAnnotations},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: "test-sa",
+					InitContainers:     []corev1.Container{{Name: "migrate"}},
+					Containers:         []corev1.Container{{Name: "app"}, {Name: "worker"}},
+				},
+			}
+			if _, err := mw.mutatePod(context.TODO(), pod, "test-namespace", false); err != nil {
+				t.Fatalf("mutatingWebhook.mutatePod() unexpected error = %v", err)
+			}
+			got := pod.Annotations
+			if tt.want[injectionStatusKey] == injectionStatusInjected {
+				if got[configHashKey] == "" {
+					t.Errorf("mutatingWebhook.mutatePod() missing %s annotation", configHashKey)
+				}
+				delete(got, configHashKey)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("mutatingWebhook.mutatePod() annotations mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
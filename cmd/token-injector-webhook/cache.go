@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// cache lookup results, used as metric label values
+	cacheResultHit    = "hit"
+	cacheResultMiss   = "miss"
+	cacheResultBypass = "bypass"
+
+	// default resync period of the ServiceAccount informers
+	defaultCacheResync = 10 * time.Minute
+)
+
+// cacheMetrics holds the Prometheus metrics describing the ServiceAccount cache efficiency.
+type cacheMetrics struct {
+	lookups *prometheus.CounterVec
+	stale   prometheus.Counter
+}
+
+// newCacheMetrics creates the ServiceAccount cache metrics and registers them with the given registerer.
+func newCacheMetrics(reg prometheus.Registerer) (*cacheMetrics, error) {
+	m := &cacheMetrics{
+		lookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "token_injector",
+			Subsystem: "serviceaccount_cache",
+			Name:      "lookups_total",
+			Help:      "ServiceAccount cache lookups by result (hit, miss, bypass).",
+		}, []string{"result"}),
+		stale: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "token_injector",
+			Subsystem: "serviceaccount_cache",
+			Name:      "stale_total",
+			Help:      "Cache misses for ServiceAccounts that exist in the API server (the cache lagged behind).",
+		}),
+	}
+	for _, c := range []prometheus.Collector{m.lookups, m.stale} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// namespaceInformer is a ServiceAccount informer limited to a single namespace.
+type namespaceInformer struct {
+	factory informers.SharedInformerFactory
+	lister  corev1listers.ServiceAccountLister
+	synced  cache.InformerSynced
+	stop    chan struct{}
+}
+
+// serviceAccountCache serves ServiceAccounts from shared-informer listers and falls back
+// to a direct API server GET on a cache miss.
+// Without a namespace selector a single cluster-wide informer is used; with a selector,
+// a ServiceAccount informer is started for every namespace matching it, and lookups in
+// other namespaces bypass the cache.
+type serviceAccountCache struct {
+	client  kubernetes.Interface
+	resync  time.Duration
+	metrics *cacheMetrics
+
+	// cluster-wide mode
+	lister corev1listers.ServiceAccountLister
+	synced cache.InformerSynced
+
+	// namespace selector mode
+	selector   labels.Selector
+	nsSynced   cache.InformerSynced
+	mu         sync.RWMutex
+	namespaces map[string]*namespaceInformer
+	// set once the informers of the initially matching namespaces have synced
+	initialSynced atomic.Bool
+}
+
+// newServiceAccountCache creates a ServiceAccount cache; an empty selector caches all namespaces.
+func newServiceAccountCache(client kubernetes.Interface, selector string, resync time.Duration,
+	metrics *cacheMetrics) (*serviceAccountCache, error) {
+	c := &serviceAccountCache{
+		client:     client,
+		resync:     resync,
+		metrics:    metrics,
+		namespaces: map[string]*namespaceInformer{},
+	}
+	if selector != "" {
+		s, err := labels.Parse(selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespace selector %q: %w", selector, err)
+		}
+		c.selector = s
+	}
+	return c, nil
+}
+
+// stripManagedFields drops managed fields from cached objects to reduce the cache memory footprint.
+func stripManagedFields(obj interface{}) (interface{}, error) {
+	if accessor, ok := obj.(metav1.Object); ok {
+		accessor.SetManagedFields(nil)
+	}
+	return obj, nil
+}
+
+// start starts the informers; they run until the stop channel is closed.
+func (c *serviceAccountCache) start(stop <-chan struct{}) error {
+	if c.selector == nil {
+		factory := informers.NewSharedInformerFactory(c.client, c.resync)
+		saInformer := factory.Core().V1().ServiceAccounts()
+		if err := saInformer.Informer().SetTransform(stripManagedFields); err != nil {
+			return err
+		}
+		c.lister = saInformer.Lister()
+		c.synced = saInformer.Informer().HasSynced
+		factory.Start(stop)
+		return nil
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(c.client, c.resync,
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = c.selector.String()
+		}))
+	nsInformer := factory.Core().V1().Namespaces().Informer()
+	registration, err := nsInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if ns, ok := obj.(*corev1.Namespace); ok {
+				c.addNamespace(ns.Name)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if ns, ok := obj.(*corev1.Namespace); ok {
+				c.removeNamespace(ns.Name)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+	// the handler registration is synced once the initial namespaces were delivered to the handler
+	c.nsSynced = registration.HasSynced
+	factory.Start(stop)
+	go func() {
+		<-stop
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for name, nsi := range c.namespaces {
+			close(nsi.stop)
+			go nsi.factory.Shutdown()
+			delete(c.namespaces, name)
+		}
+	}()
+	return nil
+}
+
+// addNamespace starts a ServiceAccount informer for the namespace, if not started yet.
+func (c *serviceAccountCache) addNamespace(ns string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.namespaces[ns]; ok {
+		return
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(c.client, c.resync, informers.WithNamespace(ns))
+	saInformer := factory.Core().V1().ServiceAccounts()
+	if err := saInformer.Informer().SetTransform(stripManagedFields); err != nil {
+		logger.WithField("namespace", ns).WithError(err).Warn("error setting service account informer transform")
+	}
+	nsi := &namespaceInformer{
+		factory: factory,
+		lister:  saInformer.Lister(),
+		synced:  saInformer.Informer().HasSynced,
+		stop:    make(chan struct{}),
+	}
+	factory.Start(nsi.stop)
+	c.namespaces[ns] = nsi
+	logger.WithField("namespace", ns).Debug("started service account informer")
+}
+
+// removeNamespace stops the ServiceAccount informer of the namespace.
+func (c *serviceAccountCache) removeNamespace(ns string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if nsi, ok := c.namespaces[ns]; ok {
+		close(nsi.stop)
+		go nsi.factory.Shutdown()
+		delete(c.namespaces, ns)
+		logger.WithField("namespace", ns).Debug("stopped service account informer")
+	}
+}
+
+// hasSynced reports whether the cache has completed its initial sync. With a namespace selector, the
+// informers of the namespaces matching it later are not waited for: their lookups bypass the cache
+// until they have synced.
+func (c *serviceAccountCache) hasSynced() bool {
+	if c.selector == nil {
+		return c.synced != nil && c.synced()
+	}
+	if c.initialSynced.Load() {
+		return true
+	}
+	if c.nsSynced == nil || !c.nsSynced() {
+		return false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, nsi := range c.namespaces {
+		if !nsi.synced() {
+			return false
+		}
+	}
+	c.initialSynced.Store(true)
+	return true
+}
+
+// listerFor returns the synced lister serving the namespace, or nil if the namespace is not cached.
+func (c *serviceAccountCache) listerFor(ns string) corev1listers.ServiceAccountLister {
+	if c.selector == nil {
+		if c.synced == nil || !c.synced() {
+			return nil
+		}
+		return c.lister
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	nsi, ok := c.namespaces[ns]
+	if !ok || !nsi.synced() {
+		return nil
+	}
+	return nsi.lister
+}
+
+// get returns the ServiceAccount from the cache, falling back to a direct GET on a cache miss.
+// The returned object is shared with the cache and must not be modified.
+func (c *serviceAccountCache) get(ctx context.Context, name, ns string) (*corev1.ServiceAccount, error) {
+	lister := c.listerFor(ns)
+	if lister == nil {
+		c.metrics.lookups.WithLabelValues(cacheResultBypass).Inc()
+		return c.client.CoreV1().ServiceAccounts(ns).Get(ctx, name, metav1.GetOptions{})
+	}
+	sa, err := lister.ServiceAccounts(ns).Get(name)
+	if err == nil {
+		c.metrics.lookups.WithLabelValues(cacheResultHit).Inc()
+		return sa, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	c.metrics.lookups.WithLabelValues(cacheResultMiss).Inc()
+	sa, err = c.client.CoreV1().ServiceAccounts(ns).Get(ctx, name, metav1.GetOptions{})
+	if err == nil {
+		c.metrics.stale.Inc()
+	}
+	return sa, err
+}
+
+// namespaceCache serves Namespaces from a cluster-wide shared-informer lister and falls back
+// to a direct API server GET on a cache miss.
+type namespaceCache struct {
+	client kubernetes.Interface
+	resync time.Duration
+	lister corev1listers.NamespaceLister
+	synced cache.InformerSynced
+}
+
+// newNamespaceCache creates a Namespace cache.
+func newNamespaceCache(client kubernetes.Interface, resync time.Duration) *namespaceCache {
+	return &namespaceCache{client: client, resync: resync}
+}
+
+// start starts the Namespace informer; it runs until the stop channel is closed.
+func (c *namespaceCache) start(stop <-chan struct{}) error {
+	factory := informers.NewSharedInformerFactory(c.client, c.resync)
+	nsInformer := factory.Core().V1().Namespaces()
+	if err := nsInformer.Informer().SetTransform(stripManagedFields); err != nil {
+		return err
+	}
+	c.lister = nsInformer.Lister()
+	c.synced = nsInformer.Informer().HasSynced
+	factory.Start(stop)
+	return nil
+}
+
+// hasSynced reports whether the Namespace informer has completed its initial sync.
+func (c *namespaceCache) hasSynced() bool {
+	return c.synced != nil && c.synced()
+}
+
+// get returns the Namespace from the cache, falling back to a direct GET on a cache miss.
+// The returned object is shared with the cache and must not be modified.
+func (c *namespaceCache) get(ctx context.Context, name string) (*corev1.Namespace, error) {
+	if c.hasSynced() {
+		if ns, err := c.lister.Get(name); err == nil {
+			return ns, nil
+		}
+	}
+	return c.client.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestServiceAccountCache(t *testing.T, selector string, objects ...runtime.Object) *serviceAccountCache {
+	t.Helper()
+	m, err := newCacheMetrics(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatalf("newCacheMetrics() error = %v", err)
+	}
+	c, err := newServiceAccountCache(fake.NewSimpleClientset(objects...), selector, 0, m)
+	if err != nil {
+		t.Fatalf("newServiceAccountCache() error = %v", err)
+	}
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	if err = c.start(stop); err != nil {
+		t.Fatalf("serviceAccountCache.start() error = %v", err)
+	}
+	if err = wait.PollUntilContextTimeout(context.TODO(), 10*time.Millisecond, 5*time.Second, true,
+		func(context.Context) (bool, error) { return c.hasSynced(), nil }); err != nil {
+		t.Fatalf("serviceAccountCache did not sync: %v", err)
+	}
+	return c
+}
+
+func Test_serviceAccountCache_get(t *testing.T) {
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "test-sa", Namespace: "test-namespace"}}
+	c := newTestServiceAccountCache(t, "", sa)
+
+	got, err := c.get(context.TODO(), "test-sa", "test-namespace")
+	if err != nil || got.Name != "test-sa" {
+		t.Fatalf("serviceAccountCache.get() = %v, %v", got, err)
+	}
+	if hits := testutil.ToFloat64(c.metrics.lookups.WithLabelValues(cacheResultHit)); hits != 1 {
+		t.Errorf("cache hits = %v, want 1", hits)
+	}
+
+	_, err = c.get(context.TODO(), "missing-sa", "test-namespace")
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("serviceAccountCache.get() error = %v, want not found", err)
+	}
+	if misses := testutil.ToFloat64(c.metrics.lookups.WithLabelValues(cacheResultMiss)); misses != 1 {
+		t.Errorf("cache misses = %v, want 1", misses)
+	}
+	if stale := testutil.ToFloat64(c.metrics.stale); stale != 0 {
+		t.Errorf("cache stale = %v, want 0", stale)
+	}
+}
+
+func Test_serviceAccountCache_namespaceSelector(t *testing.T) {
+	objects := []runtime.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "cached", Labels: map[string]string{"cache": "true"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other"}},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "test-sa", Namespace: "cached"}},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "test-sa", Namespace: "other"}},
+	}
+	c := newTestServiceAccountCache(t, "cache=true", objects...)
+
+	if _, err := c.get(context.TODO(), "test-sa", "other"); err != nil {
+		t.Fatalf("serviceAccountCache.get() error = %v", err)
+	}
+	if bypass := testutil.ToFloat64(c.metrics.lookups.WithLabelValues(cacheResultBypass)); bypass != 1 {
+		t.Errorf("cache bypass = %v, want 1", bypass)
+	}
+	if _, err := c.get(context.TODO(), "test-sa", "cached"); err != nil {
+		t.Fatalf("serviceAccountCache.get() error = %v", err)
+	}
+	if hits := testutil.ToFloat64(c.metrics.lookups.WithLabelValues(cacheResultHit)); hits != 1 {
+		t.Errorf("cache hits = %v, want 1", hits)
+	}
+}
+
+func Test_newServiceAccountCache_invalidSelector(t *testing.T) {
+	if _, err := newServiceAccountCache(fake.NewSimpleClientset(), "a in (", 0, nil); err == nil {
+		t.Error("newServiceAccountCache() expected error for invalid selector")
+	}
+}
+
+func Test_serviceAccountCache_hasSynced_laterNamespace(t *testing.T) {
+	objects := []runtime.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "cached", Labels: map[string]string{"cache": "true"}}},
+	}
+	c := newTestServiceAccountCache(t, "cache=true", objects...)
+
+	// a namespace matching the selector after the initial sync does not make the cache unsynced
+	c.mu.Lock()
+	c.namespaces["created-later"] = &namespaceInformer{synced: func() bool { return false }}
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.namespaces, "created-later")
+		c.mu.Unlock()
+	}()
+	if !c.hasSynced() {
+		t.Errorf("serviceAccountCache.hasSynced() = false after the initial sync")
+	}
+	if lister := c.listerFor("created-later"); lister != nil {
+		t.Errorf("serviceAccountCache.listerFor() returned the lister of an unsynced namespace")
+	}
+}
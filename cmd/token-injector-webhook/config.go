@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	whmodel "github.com/slok/kubewebhook/v2/pkg/model"
+	"github.com/slok/kubewebhook/v2/pkg/webhook/mutating"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// default interval between checks of the configuration file
+const defaultConfigReloadInterval = 10 * time.Second
+
+// webhookConfig is the webhook configuration file (YAML or JSON). Settings it omits keep the value of
+// the matching server flag.
+type webhookConfig struct {
+	Image            string          `json:"image,omitempty"`
+	PullPolicy       string          `json:"pullPolicy,omitempty"`
+	VolumeName       string          `json:"volumeName,omitempty"`
+	VolumePath       string          `json:"volumePath,omitempty"`
+	TokenFile        string          `json:"tokenFile,omitempty"`
+	Injector         *injectorConfig `json:"injector,omitempty"`
+	Env              []corev1.EnvVar `json:"env,omitempty"`
+	FailureMode      string          `json:"failureMode,omitempty"`
+	ConflictPolicy   string          `json:"conflictPolicy,omitempty"`
+	RolePolicyAction string          `json:"rolePolicyAction,omitempty"`
+}
+
+// injectorConfig holds the token-injector containers resources and security context settings.
+type injectorConfig struct {
+	Resources              *injectorResourcesConfig `json:"resources,omitempty"`
+	RunAsNonRoot           *bool                    `json:"runAsNonRoot,omitempty"`
+	RunAsUser              *int64                   `json:"runAsUser,omitempty"`
+	ReadOnlyRootFilesystem *bool                    `json:"readOnlyRootFilesystem,omitempty"`
+	DropCapabilities       *string                  `json:"dropCapabilities,omitempty"`
+	SeccompProfile         *string                  `json:"seccompProfile,omitempty"`
+}
+
+// injectorResourcesConfig holds the token-injector containers requests and limits; an empty value sets none.
+type injectorResourcesConfig struct {
+	Requests resourceValues `json:"requests,omitempty"`
+	Limits   resourceValues `json:"limits,omitempty"`
+}
+
+// resourceValues holds CPU and memory quantities.
+type resourceValues struct {
+	CPU    *string `json:"cpu,omitempty"`
+	Memory *string `json:"memory,omitempty"`
+}
+
+// parseWebhookConfig parses a YAML or JSON webhook configuration, rejecting unknown fields.
+func parseWebhookConfig(data []byte) (*webhookConfig, error) {
+	c := &webhookConfig{}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return nil, fmt.Errorf("invalid webhook configuration: %w", err)
+	}
+	return c, nil
+}
+
+// apply returns a copy of the webhook with the configuration applied, after validating the result.
+func (c *webhookConfig) apply(base *mutatingWebhook) (*mutatingWebhook, error) {
+	mw := *base
+	for _, s := range []struct {
+		field *string
+		value string
+	}{
+		{&mw.image, c.Image},
+		{&mw.pullPolicy, c.PullPolicy},
+		{&mw.volumeName, c.VolumeName},
+		{&mw.volumePath, c.VolumePath},
+		{&mw.tokenFile, c.TokenFile},
+		{&mw.failureMode, c.FailureMode},
+		{&mw.conflictPolicy, c.ConflictPolicy},
+		{&mw.rolePolicyAction, c.RolePolicyAction},
+	} {
+		if s.value != "" {
+			*s.field = s.value
+		}
+	}
+	if err := validateFailureMode(mw.failureMode); err != nil {
+		return nil, err
+	}
+	if err := validateConflictPolicy(mw.conflictPolicy); err != nil {
+		return nil, err
+	}
+	if err := validateRolePolicyAction(mw.rolePolicyAction); err != nil {
+		return nil, err
+	}
+	if err := validatePullPolicy(mw.pullPolicy); err != nil {
+		return nil, err
+	}
+	if c.Injector != nil {
+		spec := defaultInjectorSpec()
+		if mw.injector != nil {
+			spec = *mw.injector
+		}
+		c.Injector.applyTo(&spec)
+		if err := spec.validate(); err != nil {
+			return nil, err
+		}
+		mw.injector = &spec
+	}
+	for _, v := range c.Env {
+		if v.Name == "" {
+			return nil, errors.New("invalid env default: empty name")
+		}
+	}
+	if c.Env != nil {
+		mw.defaultEnv = c.Env
+	}
+	return &mw, nil
+}
+
+// applyTo overrides the injector spec with the configured settings.
+func (c *injectorConfig) applyTo(spec *injectorSpec) {
+	if r := c.Resources; r != nil {
+		for _, q := range []struct {
+			field *string
+			value *string
+		}{
+			{&spec.requestsCPU, r.Requests.CPU},
+			{&spec.requestsMemory, r.Requests.Memory},
+			{&spec.limitsCPU, r.Limits.CPU},
+			{&spec.limitsMemory, r.Limits.Memory},
+		} {
+			if q.value != nil {
+				*q.field = *q.value
+			}
+		}
+	}
+	if c.RunAsNonRoot != nil {
+		spec.runAsNonRoot = *c.RunAsNonRoot
+	}
+	if c.RunAsUser != nil {
+		spec.runAsUser = *c.RunAsUser
+	}
+	if c.ReadOnlyRootFilesystem != nil {
+		spec.readOnlyRootFilesystem = *c.ReadOnlyRootFilesystem
+	}
+	if c.DropCapabilities != nil {
+		spec.dropCapabilities = *c.DropCapabilities
+	}
+	if c.SeccompProfile != nil {
+		spec.seccompProfile = *c.SeccompProfile
+	}
+}
+
+// activeConfig is the webhook with the configuration file applied, and the file hash.
+type activeConfig struct {
+	webhook *mutatingWebhook
+	hash    string
+	data    []byte
+}
+
+// configWatcher applies the configuration file to the webhook configured by the server flags, and
+// reloads it when it changes. A new version is validated before being swapped in atomically; an invalid
+// version is logged and the active configuration is kept.
+type configWatcher struct {
+	file   string
+	base   *mutatingWebhook
+	active atomic.Pointer[activeConfig]
+
+	info    *prometheus.GaugeVec
+	reloads *prometheus.CounterVec
+}
+
+// newConfigWatcher creates a configuration file watcher, loads the file, and registers the configuration
+// metrics with the given registerer.
+func newConfigWatcher(file string, base *mutatingWebhook, reg prometheus.Registerer) (*configWatcher, error) {
+	w := &configWatcher{
+		file: file,
+		base: base,
+		info: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "token_injector",
+			Subsystem: "config",
+			Name:      "info",
+			Help:      "Active webhook configuration file, by SHA-256 hash.",
+		}, []string{"hash"}),
+		reloads: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "token_injector",
+			Subsystem: "config",
+			Name:      "reloads_total",
+			Help:      "Webhook configuration file reloads by result (success, failure).",
+		}, []string{"result"}),
+	}
+	for _, c := range []prometheus.Collector{w.info, w.reloads} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := w.reload(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// reload loads the configuration file if its content changed; it reports whether a new version was applied.
+func (w *configWatcher) reload() (bool, error) {
+	data, err := os.ReadFile(w.file)
+	if err != nil {
+		return false, err
+	}
+	active := w.active.Load()
+	if active != nil && bytes.Equal(data, active.data) {
+		return false, nil
+	}
+	config, err := parseWebhookConfig(data)
+	if err == nil {
+		var mw *mutatingWebhook
+		if mw, err = config.apply(w.base); err == nil {
+			sum := sha256.Sum256(data)
+			next := &activeConfig{webhook: mw, hash: hex.EncodeToString(sum[:]), data: data}
+			w.active.Store(next)
+			w.info.Reset()
+			w.info.WithLabelValues(next.hash).Set(1)
+			w.reloads.WithLabelValues("success").Inc()
+			return true, nil
+		}
+	}
+	w.reloads.WithLabelValues("failure").Inc()
+	return false, fmt.Errorf("%s: %w", w.file, err)
+}
+
+// watch reloads the configuration file every interval, until the stop channel is closed.
+func (w *configWatcher) watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			reloaded, err := w.reload()
+			if err != nil {
+				logger.WithError(err).Error("error reloading webhook configuration, keeping the active one")
+			} else if reloaded {
+				logger.WithField("hash", w.active.Load().hash).Info("reloaded webhook configuration")
+			}
+		}
+	}
+}
+
+// podMutator mutates the pod with the active configuration.
+func (w *configWatcher) podMutator(ctx context.Context, ar *whmodel.AdmissionReview, obj metav1.Object) (
+	*mutating.MutatorResult, error) {
+	return w.active.Load().webhook.podMutator(ctx, ar, obj)
+}
+
+// check returns the readiness check reporting the active configuration hash.
+func (w *configWatcher) check() healthCheck {
+	return healthCheck{
+		name: "config",
+		check: func(context.Context) error {
+			if w.active.Load() == nil {
+				return errors.New("webhook configuration not loaded")
+			}
+			return nil
+		},
+		detail: func() string {
+			if active := w.active.Load(); active != nil {
+				return "sha256:" + active.hash
+			}
+			return ""
+		},
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+const testConfigFile = `
+image: example.com/token-injector:v2
+pullPolicy: Always
+injector:
+  resources:
+    requests:
+      cpu: 10m
+    limits:
+      memory: ""
+  runAsUser: 1000
+env:
+- name: AWS_MAX_ATTEMPTS
+  value: "5"
+conflictPolicy: injected
+`
+
+func Test_webhookConfig_apply(t *testing.T) {
+	base := &mutatingWebhook{
+		image:            "example.com/token-injector:v1",
+		pullPolicy:       "IfNotPresent",
+		volumeName:       tokenVolumeName,
+		volumePath:       tokenVolumePath,
+		tokenFile:        tokenFileName,
+		failureMode:      failureModeAllow,
+		conflictPolicy:   conflictPolicyUser,
+		rolePolicyAction: rolePolicyActionDeny,
+	}
+	c, err := parseWebhookConfig([]byte(testConfigFile))
+	if err != nil {
+		t.Fatalf("parseWebhookConfig() unexpected error = %v", err)
+	}
+	got, err := c.apply(base)
+	if err != nil {
+		t.Fatalf("webhookConfig.apply() unexpected error = %v", err)
+	}
+	if got.image != "example.com/token-injector:v2" || got.pullPolicy != "Always" || got.conflictPolicy != conflictPolicyInjected {
+		t.Errorf("webhookConfig.apply() = image %q, pull policy %q, conflict policy %q",
+			got.image, got.pullPolicy, got.conflictPolicy)
+	}
+	// settings the file does not define keep the flag values
+	if got.volumePath != tokenVolumePath || got.failureMode != failureModeAllow {
+		t.Errorf("webhookConfig.apply() = volume path %q, failure mode %q", got.volumePath, got.failureMode)
+	}
+	wantSpec := defaultInjectorSpec()
+	wantSpec.requestsCPU = "10m"
+	wantSpec.limitsMemory = ""
+	wantSpec.runAsUser = 1000
+	if diff := cmp.Diff(wantSpec, *got.injector, cmp.AllowUnexported(injectorSpec{})); diff != "" {
+		t.Errorf("webhookConfig.apply() injector mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]corev1.EnvVar{{Name: "AWS_MAX_ATTEMPTS", Value: "5"}}, got.defaultEnv); diff != "" {
+		t.Errorf("webhookConfig.apply() env mismatch (-want +got):\n%s", diff)
+	}
+	// the base webhook is left untouched
+	if base.image != "example.com/token-injector:v1" || base.injector != nil || base.defaultEnv != nil {
+		t.Errorf("webhookConfig.apply() modified the base webhook")
+	}
+}
+
+func Test_webhookConfig_invalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":           "imagePullPolicy: Always\n",
+		"invalid yaml":            "image: [\n",
+		"invalid pull policy":     "pullPolicy: Sometimes\n",
+		"invalid failure mode":    "failureMode: ignore\n",
+		"invalid conflict policy": "conflictPolicy: merge\n",
+		"invalid policy action":   "rolePolicyAction: warn\n",
+		"invalid quantity":        "injector:\n  resources:\n    limits:\n      cpu: lots\n",
+		"invalid seccomp profile": "injector:\n  seccompProfile: Strict\n",
+		"request above the limit": "injector:\n  resources:\n    requests:\n      cpu: 100m\n",
+		"env without name":        "env:\n- value: \"5\"\n",
+	}
+	base := &mutatingWebhook{failureMode: failureModeAllow, conflictPolicy: conflictPolicyUser, rolePolicyAction: rolePolicyActionDeny}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			c, err := parseWebhookConfig([]byte(data))
+			if err == nil {
+				_, err = c.apply(base)
+			}
+			if err == nil {
+				t.Errorf("webhook configuration expected error")
+			}
+		})
+	}
+}
+
+//nolint:funlen
+func Test_configWatcher(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, []byte(testConfigFile), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+		Name: "test-sa", Namespace: "test-namespace", Annotations: map[string]string{awsRoleArnKey: testRoleArn},
+	}}
+	base := &mutatingWebhook{
+		k8sClient:        fake.NewSimpleClientset(sa, testNamespace("test-namespace")),
+		image:            "example.com/token-injector:v1",
+		volumeName:       tokenVolumeName,
+		volumePath:       tokenVolumePath,
+		tokenFile:        tokenFileName,
+		failureMode:      failureModeAllow,
+		conflictPolicy:   conflictPolicyUser,
+		rolePolicyAction: rolePolicyActionDeny,
+	}
+	w, err := newConfigWatcher(file, base, prometheus.NewRegistry())
+	if err != nil {
+		t.Fatalf("newConfigWatcher() unexpected error = %v", err)
+	}
+	hash := w.active.Load().hash
+	if got := testutil.ToFloat64(w.info.WithLabelValues(hash)); got != 1 {
+		t.Errorf("config info = %v, want 1", got)
+	}
+	if got := w.check().detail(); got != "sha256:"+hash {
+		t.Errorf("config check detail = %q, want sha256:%s", got, hash)
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Labels: enabledLabels()},
+		Spec: corev1.PodSpec{
+			ServiceAccountName: "test-sa",
+			Containers:         []corev1.Container{{Name: "app", Env: []corev1.EnvVar{{Name: "AWS_MAX_ATTEMPTS", Value: "3"}}}},
+		},
+	}
+	if _, err = w.active.Load().webhook.mutatePod(context.TODO(), pod, "test-namespace", false); err != nil {
+		t.Fatalf("mutatingWebhook.mutatePod() unexpected error = %v", err)
+	}
+	if got := pod.Spec.InitContainers[0].Image; got != "example.com/token-injector:v2" {
+		t.Errorf("injector image = %q, want the configured image", got)
+	}
+	// env defaults do not override the values defined in the container
+	for _, v := range pod.Spec.Containers[0].Env {
+		if v.Name == "AWS_MAX_ATTEMPTS" && v.Value != "3" {
+			t.Errorf("AWS_MAX_ATTEMPTS = %q, want the container value", v.Value)
+		}
+	}
+
+	// an unchanged file is not reloaded
+	if reloaded, err := w.reload(); err != nil || reloaded {
+		t.Errorf("configWatcher.reload() = %v, %v, want false, nil", reloaded, err)
+	}
+	// an invalid file keeps the active configuration
+	if err = os.WriteFile(file, []byte("pullPolicy: Sometimes\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.reload(); err == nil {
+		t.Errorf("configWatcher.reload() expected error")
+	}
+	if got := w.active.Load().hash; got != hash {
+		t.Errorf("active config hash = %q, want %q", got, hash)
+	}
+	if got := testutil.ToFloat64(w.reloads.WithLabelValues("failure")); got != 1 {
+		t.Errorf("failed reloads = %v, want 1", got)
+	}
+	// a valid file is swapped in
+	if err = os.WriteFile(file, []byte("image: example.com/token-injector:v3\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := w.reload(); err != nil || !reloaded {
+		t.Errorf("configWatcher.reload() = %v, %v, want true, nil", reloaded, err)
+	}
+	active := w.active.Load()
+	if active.webhook.image != "example.com/token-injector:v3" || active.webhook.pullPolicy != "" {
+		t.Errorf("active config = image %q, pull policy %q", active.webhook.image, active.webhook.pullPolicy)
+	}
+	if got := testutil.CollectAndCount(w.info); got != 1 {
+		t.Errorf("config info series = %d, want 1", got)
+	}
+	if got := testutil.ToFloat64(w.reloads.WithLabelValues("success")); got != 2 {
+		t.Errorf("successful reloads = %v, want 2", got)
+	}
+}
+
+func Test_newConfigWatcher_invalid(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := newConfigWatcher(filepath.Join(dir, "missing.yaml"), &mutatingWebhook{}, prometheus.NewRegistry()); err == nil {
+		t.Errorf("newConfigWatcher() expected error for a missing file")
+	}
+	file := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(file, []byte("failureMode: ignore\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := newConfigWatcher(file, &mutatingWebhook{}, prometheus.NewRegistry())
+	if err == nil || !strings.Contains(err.Error(), file) {
+		t.Errorf("newConfigWatcher() error = %v, want an error naming the file", err)
+	}
+}
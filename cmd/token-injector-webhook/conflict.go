@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+)
+
+const (
+	// pod annotation overriding the webhook conflict policy
+	conflictPolicyKey = "token-injector.io/conflict-policy"
+
+	// conflict policies; decide what happens when a pod already defines an injected env var, volume or mount
+	conflictPolicyUser     = "user"     // user defined values win
+	conflictPolicyInjected = "injected" // injected values win
+	conflictPolicyReject   = "reject"   // the pod is rejected
+)
+
+// validateConflictPolicy checks that the conflict policy is one of the supported values.
+func validateConflictPolicy(policy string) error {
+	switch policy {
+	case conflictPolicyUser, conflictPolicyInjected, conflictPolicyReject:
+		return nil
+	default:
+		return fmt.Errorf("invalid conflict policy %q: must be %q, %q or %q",
+			policy, conflictPolicyUser, conflictPolicyInjected, conflictPolicyReject)
+	}
+}
+
+// merger merges injected env vars, volume mounts and volumes into a pod, resolving
+// conflicts with user defined values according to the conflict policy.
+// Existing objects matching the injected ones are left as is without raising a conflict. When the pod was
+// already injected by the webhook, the env vars injected once per pod (keepOwn) are kept as well; any other
+// difference is still resolved by the conflict policy, so that reinvocations are idempotent.
+type merger struct {
+	policy    string
+	reconcile bool
+	warnings  []string
+}
+
+// newMerger creates a merger for the pod; the pod annotation takes precedence over the default policy.
+func newMerger(pod *corev1.Pod, defaultPolicy string, reconcile bool) *merger {
+	m := &merger{policy: defaultPolicy, reconcile: reconcile}
+	if m.policy == "" {
+		m.policy = conflictPolicyInjected
+	}
+	if policy, ok := pod.GetAnnotations()[conflictPolicyKey]; ok {
+		if err := validateConflictPolicy(policy); err != nil {
+			m.warnings = append(m.warnings, fmt.Sprintf("token-injector: ignoring %s annotation: %s", conflictPolicyKey, err))
+		} else {
+			m.policy = policy
+		}
+	}
+	return m
+}
+
+// resolve applies the conflict policy to a detected conflict.
+// It returns true if the injected value must replace the user defined one.
+func (m *merger) resolve(conflict string) (bool, error) {
+	switch m.policy {
+	case conflictPolicyReject:
+		return false, &admissionDeniedError{reason: fmt.Sprintf("token-injector: pod rejected, %s (conflict policy: %s)",
+			conflict, m.policy)}
+	case conflictPolicyUser:
+		m.warnings = append(m.warnings, fmt.Sprintf("token-injector: %s, keeping user value (conflict policy: %s)",
+			conflict, m.policy))
+		logger.WithField("conflict policy", m.policy).Debugf("%s, keeping user value", conflict)
+		return false, nil
+	default:
+		m.warnings = append(m.warnings, fmt.Sprintf("token-injector: %s, overriding with injected value (conflict policy: %s)",
+			conflict, m.policy))
+		logger.WithField("conflict policy", m.policy).Debugf("%s, overriding with injected value", conflict)
+		return true, nil
+	}
+}
+
+// env merges the injected environment variable into the container environment.
+// If keepOwn is set, a value injected by a previous webhook invocation is kept as is.
+func (m *merger) env(container string, env []corev1.EnvVar, v corev1.EnvVar, keepOwn bool) ([]corev1.EnvVar, error) {
+	for i := range env {
+		if env[i].Name != v.Name {
+			continue
+		}
+		if env[i].ValueFrom == nil && env[i].Value == v.Value {
+			return env, nil
+		}
+		if m.reconcile && keepOwn {
+			// resolved by the previous invocation
+			return env, nil
+		}
+		override, err := m.resolve(fmt.Sprintf("container %q already defines %s", container, v.Name))
+		if err != nil {
+			return nil, err
+		}
+		return upsertEnvVar(env, v, !override), nil
+	}
+	return append(env, v), nil
+}
+
+// mount merges the injected volume mount into the container volume mounts.
+// Conflicts are another volume mounted at the injected path, or the injected volume mounted at another path.
+func (m *merger) mount(container string, mounts []corev1.VolumeMount, vm corev1.VolumeMount) ([]corev1.VolumeMount, error) {
+	for i := range mounts {
+		switch {
+		case mounts[i].Name == vm.Name && mounts[i].MountPath == vm.MountPath:
+			return upsertVolumeMount(mounts, vm), nil
+		case mounts[i].Name == vm.Name || mounts[i].MountPath == vm.MountPath:
+			override, err := m.resolve(fmt.Sprintf("container %q already mounts volume %q at %s",
+				container, mounts[i].Name, mounts[i].MountPath))
+			if err != nil {
+				return nil, err
+			}
+			if !override {
+				return mounts, nil
+			}
+			// drop the conflicting user mount, then merge the injected one again
+			return m.mount(container, append(mounts[:i:i], mounts[i+1:]...), vm)
+		}
+	}
+	return append(mounts, vm), nil
+}
+
+// volume merges the injected volume into the pod volumes.
+func (m *merger) volume(volumes []corev1.Volume, v corev1.Volume) ([]corev1.Volume, error) {
+	for i := range volumes {
+		if volumes[i].Name != v.Name {
+			continue
+		}
+		if apiequality.Semantic.DeepEqual(volumes[i].VolumeSource, v.VolumeSource) {
+			return volumes, nil
+		}
+		override, err := m.resolve(fmt.Sprintf("pod already defines volume %q", v.Name))
+		if err != nil {
+			return nil, err
+		}
+		if !override {
+			return volumes, nil
+		}
+		break
+	}
+	return upsertVolume(volumes, v), nil
+}
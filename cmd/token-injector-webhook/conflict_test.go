@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	cmp "github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
+)
+
+const testRoleArn = "arn:aws:iam::123456789012:role/testrole"
+
+//nolint:funlen
+func Test_mutatingWebhook_mutateContainers_conflicts(t *testing.T) {
+	userContainer := func() []corev1.Container {
+		return []corev1.Container{
+			{
+				Name:         "TestContainer",
+				Env:          []corev1.EnvVar{{Name: awsRoleArn, Value: "arn:aws:iam::210987654321:role/userrole"}},
+				VolumeMounts: []corev1.VolumeMount{{Name: "user-volume", MountPath: tokenVolumePath}},
+			},
+		}
+	}
+	tests := []struct {
+		name           string
+		policy         string
+		annotation     string
+		wantEnv        []corev1.EnvVar
+		wantMounts     []corev1.VolumeMount
+		wantWarnings   int
+		wantRejection  bool
+		wantPolicyUsed string
+	}{
+		{
+			name:   "injected values win",
+			policy: conflictPolicyInjected,
+			wantEnv: []corev1.EnvVar{
+				{Name: awsRoleArn, Value: testRoleArn},
+				{Name: awsWebIdentityTokenFile, Value: tokenVolumePath + "/" + tokenFileName},
+				{Name: awsRoleSessionName, Value: "token-injector-webhook-0000000000000000"},
+			},
+			wantMounts:     []corev1.VolumeMount{{Name: tokenVolumeName, MountPath: tokenVolumePath}},
+			wantWarnings:   2,
+			wantPolicyUsed: conflictPolicyInjected,
+		},
+		{
+			name:   "user values win",
+			policy: conflictPolicyUser,
+			wantEnv: []corev1.EnvVar{
+				{Name: awsRoleArn, Value: "arn:aws:iam::210987654321:role/userrole"},
+				{Name: awsWebIdentityTokenFile, Value: tokenVolumePath + "/" + tokenFileName},
+				{Name: awsRoleSessionName, Value: "token-injector-webhook-0000000000000000"},
+			},
+			wantMounts:     []corev1.VolumeMount{{Name: "user-volume", MountPath: tokenVolumePath}},
+			wantWarnings:   2,
+			wantPolicyUsed: conflictPolicyUser,
+		},
+		{
+			name:          "reject pod",
+			policy:        conflictPolicyReject,
+			wantRejection: true,
+		},
+		{
+			name:       "pod annotation overrides policy",
+			policy:     conflictPolicyInjected,
+			annotation: conflictPolicyReject,
+			// rejected by the annotation policy
+			wantRejection: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{}
+			if tt.annotation != "" {
+				pod.ObjectMeta = metav1.ObjectMeta{Annotations: map[string]string{conflictPolicyKey: tt.annotation}}
+			}
+			mw := &mutatingWebhook{volumeName: tokenVolumeName, volumePath: tokenVolumePath, tokenFile: tokenFileName}
+			m := newMerger(pod, tt.policy, false)
+			containers := userContainer()
+			_, err := mw.mutateContainers(containers, testRoleArn, nil, sessionNameData{Random: randomString(16)}, containerSelector{}, m)
+			var denied *admissionDeniedError
+			if tt.wantRejection {
+				if !errors.As(err, &denied) {
+					t.Fatalf("mutatingWebhook.mutateContainers() error = %v, want rejection", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("mutatingWebhook.mutateContainers() unexpected error = %v", err)
+			}
+			if m.policy != tt.wantPolicyUsed {
+				t.Errorf("merger policy = %v, want %v", m.policy, tt.wantPolicyUsed)
+			}
+			if !cmp.Equal(containers[0].Env, tt.wantEnv) {
+				t.Errorf("mutatingWebhook.mutateContainers() env diff %v", cmp.Diff(containers[0].Env, tt.wantEnv))
+			}
+			if !cmp.Equal(containers[0].VolumeMounts, tt.wantMounts) {
+				t.Errorf("mutatingWebhook.mutateContainers() mounts diff %v", cmp.Diff(containers[0].VolumeMounts, tt.wantMounts))
+			}
+			if len(m.warnings) != tt.wantWarnings {
+				t.Errorf("merger warnings = %v, want %d", m.warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func Test_merger_volume(t *testing.T) {
+	userVolume := corev1.Volume{Name: tokenVolumeName, VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/tmp"}}}
+	tests := []struct {
+		name      string
+		policy    string
+		reconcile bool
+		existing  *corev1.Volume
+		want      corev1.Volume
+		wantErr   bool
+	}{
+		{name: "injected volume wins", policy: conflictPolicyInjected, want: getInjectorVolume(tokenVolumeName)},
+		{name: "user volume wins", policy: conflictPolicyUser, want: userVolume},
+		{name: "reject volume collision", policy: conflictPolicyReject, wantErr: true},
+		{name: "reconcile own volume", policy: conflictPolicyReject, reconcile: true, existing: ptr.To(getInjectorVolume(tokenVolumeName)),
+			want: getInjectorVolume(tokenVolumeName)},
+		{name: "reconcile keeps user volume", policy: conflictPolicyUser, reconcile: true, want: userVolume},
+		{name: "reconcile rejects volume collision", policy: conflictPolicyReject, reconcile: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMerger(&corev1.Pod{}, tt.policy, tt.reconcile)
+			existing := userVolume
+			if tt.existing != nil {
+				existing = *tt.existing
+			}
+			got, err := m.volume([]corev1.Volume{existing}, getInjectorVolume(tokenVolumeName))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("merger.volume() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !cmp.Equal(got, []corev1.Volume{tt.want}) {
+				t.Errorf("merger.volume() diff %v", cmp.Diff(got, []corev1.Volume{tt.want}))
+			}
+		})
+	}
+}
+
+func Test_newMerger_invalidAnnotation(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{conflictPolicyKey: "whatever"}}}
+	m := newMerger(pod, conflictPolicyUser, false)
+	if m.policy != conflictPolicyUser || len(m.warnings) != 1 {
+		t.Errorf("newMerger() policy = %v, warnings = %v", m.policy, m.warnings)
+	}
+}
+
+func Test_mutatingWebhook_mutatePod_reinvocationConflicts(t *testing.T) {
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+		Name: "test-sa", Namespace: "test-namespace", Annotations: map[string]string{awsRoleArnKey: testRoleArn},
+	}}
+	mw := &mutatingWebhook{
+		k8sClient:      fake.NewSimpleClientset(sa, testNamespace("test-namespace")),
+		volumeName:     tokenVolumeName,
+		volumePath:     tokenVolumePath,
+		tokenFile:      tokenFileName,
+		conflictPolicy: conflictPolicyUser,
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Labels: enabledLabels()},
+		Spec: corev1.PodSpec{
+			ServiceAccountName: "test-sa",
+			Containers:         []corev1.Container{{Name: "app", Env: []corev1.EnvVar{{Name: awsRoleArn, Value: "user-value"}}}},
+		},
+	}
+	// the user value is kept by every invocation
+	for i := 0; i < 2; i++ {
+		if _, err := mw.mutatePod(context.TODO(), pod, "test-namespace", false); err != nil {
+			t.Fatalf("invocation %d: mutatingWebhook.mutatePod() unexpected error = %v", i, err)
+		}
+		for _, v := range pod.Spec.Containers[0].Env {
+			if v.Name == awsRoleArn && v.Value != "user-value" {
+				t.Errorf("invocation %d: %s = %q, want the user value", i, awsRoleArn, v.Value)
+			}
+		}
+	}
+
+	// a user volume with the injected name is not mistaken for an injected one
+	mw.conflictPolicy = conflictPolicyReject
+	pod = &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Labels: enabledLabels()},
+		Spec: corev1.PodSpec{
+			ServiceAccountName: "test-sa",
+			Containers:         []corev1.Container{{Name: "app"}},
+			Volumes: []corev1.Volume{{Name: tokenVolumeName, VolumeSource: corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{Path: "/tmp"},
+			}}},
+		},
+	}
+	_, err := mw.mutatePod(context.TODO(), pod, "test-namespace", false)
+	var denied *admissionDeniedError
+	if !errors.As(err, &denied) {
+		t.Errorf("mutatingWebhook.mutatePod() error = %v, want rejection", err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	// component reported as source of the Kubernetes Events
+	eventSourceComponent = "token-injector-webhook"
+
+	// default rate limit of the Events on a single object: a burst, then one every 5 minutes
+	defaultEventsBurst = 25
+	defaultEventsQPS   = 1.0 / 300
+
+	// Event reasons
+	eventReasonInvalidRoleArn    = "InvalidRoleArn"
+	eventReasonRoleArnNotAllowed = "RoleArnNotAllowed"
+	eventReasonInjectionSkipped  = "InjectionSkipped"
+	eventReasonInjectionFailed   = "InjectionFailed"
+)
+
+// newEventRecorder creates an EventRecorder sending Events to the API server. Events on the same object
+// are aggregated, and rate limited to the burst, then qps.
+func newEventRecorder(client kubernetes.Interface, qps float32, burst int) record.EventRecorder {
+	broadcaster := record.NewBroadcaster(record.WithCorrelatorOptions(record.CorrelatorOptions{QPS: qps, BurstSize: burst}))
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: eventSourceComponent})
+}
+
+// podOwnerReference returns a reference to the pod controller (or first owner), or nil for a bare pod.
+func podOwnerReference(pod *corev1.Pod, ns string) *corev1.ObjectReference {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		if len(pod.OwnerReferences) == 0 {
+			return nil
+		}
+		owner = &pod.OwnerReferences[0]
+	}
+	return &corev1.ObjectReference{
+		APIVersion: owner.APIVersion,
+		Kind:       owner.Kind,
+		Name:       owner.Name,
+		UID:        owner.UID,
+		Namespace:  ns,
+	}
+}
+
+// recordServiceAccountEvent records a warning Event on the ServiceAccount, if Events are enabled.
+func (mw *mutatingWebhook) recordServiceAccountEvent(sa *corev1.ServiceAccount, reason, message string) {
+	if mw.events == nil {
+		return
+	}
+	mw.events.Event(sa, corev1.EventTypeWarning, reason, message)
+}
+
+// recordOwnerEvent records an Event on the pod owner about the injection outcome, if Events are enabled:
+// a warning if the injection failed, or a normal Event if it was skipped. Bare pods get no Event.
+func (mw *mutatingWebhook) recordOwnerEvent(pod *corev1.Pod, ns string, err error) {
+	if mw.events == nil {
+		return
+	}
+	owner := podOwnerReference(pod, ns)
+	if owner == nil {
+		return
+	}
+	if err != nil {
+		mw.events.Eventf(owner, corev1.EventTypeWarning, eventReasonInjectionFailed,
+			"AWS credentials injection failed for pod %s: %s", podDisplayName(pod), err)
+		return
+	}
+	if pod.Annotations[injectionStatusKey] == injectionStatusSkipped {
+		mw.events.Eventf(owner, corev1.EventTypeNormal, eventReasonInjectionSkipped,
+			"AWS credentials injection skipped for pod %s: %s", podDisplayName(pod), pod.Annotations[skipReasonKey])
+	}
+}
+
+// podDisplayName returns the pod name, or its generate name while it has none.
+func podDisplayName(pod *corev1.Pod) string {
+	if pod.Name != "" {
+		return pod.Name
+	}
+	return fmt.Sprintf("%s*", pod.GenerateName)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+	whmodel "github.com/slok/kubewebhook/v2/pkg/model"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+)
+
+//nolint:funlen
+func Test_mutatingWebhook_podMutator_events(t *testing.T) {
+	owned := []metav1.OwnerReference{
+		{APIVersion: "v1", Kind: "ConfigMap", Name: "not-the-controller"},
+		{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "app-5d4f8", UID: "1234", Controller: ptr.To(true)},
+	}
+	tests := []struct {
+		name       string
+		saRoleArn  string
+		labels     map[string]string
+		owners     []metav1.OwnerReference
+		rolePolicy string
+		dryRun     bool
+		want       []string
+	}{
+		{
+			name:      "injected",
+			saRoleArn: testRoleArn,
+			owners:    owned,
+		},
+		{
+			name:      "malformed service account role ARN",
+			saRoleArn: "arn:aws:iam::123:role/testrole",
+			owners:    owned,
+			want: []string{
+				"Warning InvalidRoleArn involvedObject{kind=ServiceAccount,apiVersion=v1}",
+				"Warning InjectionFailed involvedObject{kind=ReplicaSet,apiVersion=apps/v1}",
+			},
+		},
+		{
+			name:       "service account role ARN not allowed",
+			saRoleArn:  "arn:aws:iam::123456789012:role/admin",
+			owners:     owned,
+			rolePolicy: "rules:\n- namespaces: [test-namespace]\n  accountIDs: [\"123456789012\"]\n  roleNames: [\"test*\"]\n",
+			want: []string{
+				"Warning RoleArnNotAllowed involvedObject{kind=ServiceAccount,apiVersion=v1}",
+				"Normal InjectionSkipped involvedObject{kind=ReplicaSet,apiVersion=apps/v1}",
+			},
+		},
+		{
+			name:   "skipped",
+			owners: owned,
+			want:   []string{"Normal InjectionSkipped involvedObject{kind=ReplicaSet,apiVersion=apps/v1}"},
+		},
+		{
+			name:   "first owner without controller",
+			owners: owned[:1],
+			want:   []string{"Normal InjectionSkipped involvedObject{kind=ConfigMap,apiVersion=v1}"},
+		},
+		{
+			name: "bare pod",
+		},
+		{
+			name:      "dry run",
+			saRoleArn: "arn:aws:iam::123:role/testrole",
+			owners:    owned,
+			dryRun:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sa := &corev1.ServiceAccount{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+				ObjectMeta: metav1.ObjectMeta{Name: "test-sa", Namespace: "test-namespace", Annotations: map[string]string{}},
+			}
+			if tt.saRoleArn != "" {
+				sa.Annotations[awsRoleArnKey] = tt.saRoleArn
+			}
+			recorder := record.NewFakeRecorder(10)
+			recorder.IncludeObject = true
+			mw := &mutatingWebhook{
+				k8sClient:        fake.NewSimpleClientset(sa, testNamespace("test-namespace")),
+				volumeName:       tokenVolumeName,
+				volumePath:       tokenVolumePath,
+				tokenFile:        tokenFileName,
+				failureMode:      failureModeAllow,
+				rolePolicyAction: rolePolicyActionSkip,
+				events:           recorder,
+			}
+			if tt.rolePolicy != "" {
+				p, err := parseRolePolicy(tt.rolePolicy)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if mw.rolePolicy, err = newRolePolicyWatcher(fake.NewSimpleClientset(), "webhook/role-policy",
+					time.Minute, prometheus.NewRegistry()); err != nil {
+					t.Fatal(err)
+				}
+				mw.rolePolicy.set(p)
+			}
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{GenerateName: "app-5d4f8-", Labels: enabledLabels(), OwnerReferences: tt.owners},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: "test-sa",
+					Containers:         []corev1.Container{{Name: "app"}},
+				},
+			}
+			if _, err := mw.podMutator(context.TODO(), &whmodel.AdmissionReview{Namespace: "test-namespace", DryRun: tt.dryRun}, pod); err != nil {
+				t.Fatalf("mutatingWebhook.podMutator() unexpected error = %v", err)
+			}
+			close(recorder.Events)
+			var got []string
+			for event := range recorder.Events {
+				// keep the type, reason and involved object of the event
+				fields := strings.Fields(event)
+				got = append(got, strings.Join([]string{fields[0], fields[1], fields[len(fields)-1]}, " "))
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("mutatingWebhook.podMutator() events mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
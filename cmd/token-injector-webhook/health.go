@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// timeout of each health check
+	defaultHealthCheckTimeout = 2 * time.Second
+	// default minimum remaining validity of the serving certificate for the webhook to be ready
+	defaultCertExpiryMargin = 24 * time.Hour
+
+	healthStatusOK     = "ok"
+	healthStatusFailed = "failed"
+)
+
+// healthCheck is a named liveness or readiness check, with optional detail.
+type healthCheck struct {
+	name   string
+	check  func(ctx context.Context) error
+	detail func() string
+}
+
+// healthCheckResult is the JSON detail of a health check.
+type healthCheckResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// healthResponse is the JSON response of the /livez and /readyz endpoints.
+type healthResponse struct {
+	Status string              `json:"status"`
+	Checks []healthCheckResult `json:"checks"`
+}
+
+// healthHandler runs the checks on each request, and responds 200 if they all pass or 503 otherwise,
+// with the per-check detail as JSON.
+func healthHandler(timeout time.Duration, checks ...healthCheck) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := healthResponse{Status: healthStatusOK, Checks: make([]healthCheckResult, 0, len(checks))}
+		for _, c := range checks {
+			result := healthCheckResult{Name: c.name, Status: healthStatusOK}
+			if c.detail != nil {
+				result.Detail = c.detail()
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			if err := c.check(ctx); err != nil {
+				result.Status, result.Error = healthStatusFailed, err.Error()
+				resp.Status = healthStatusFailed
+				logger.WithError(err).WithField("check", c.name).Debugf("%s check failed", r.URL.Path)
+			}
+			cancel()
+			resp.Checks = append(resp.Checks, result)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if resp.Status != healthStatusOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			logger.WithError(err).Error("error writing health response")
+		}
+	})
+}
+
+// pingCheck always passes: the webhook is live as long as it serves requests.
+func pingCheck() healthCheck {
+	return healthCheck{name: "ping", check: func(context.Context) error { return nil }}
+}
+
+// shutdownCheck fails once the webhook is draining before shutdown.
+func shutdownCheck() healthCheck {
+	return healthCheck{name: "shutdown", check: func(context.Context) error {
+		if draining.Load() {
+			return errors.New("shutting down")
+		}
+		return nil
+	}}
+}
+
+// apiServerCheck checks that the Kubernetes API server is reachable; the version request is bound to the
+// check timeout, so a hanging API server fails the check without leaving the request behind.
+func apiServerCheck(client kubernetes.Interface) healthCheck {
+	return healthCheck{name: "apiserver", check: func(ctx context.Context) error {
+		if err := client.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx).Error(); err != nil {
+			return fmt.Errorf("API server unreachable: %w", err)
+		}
+		return nil
+	}}
+}
+
+// cacheCheck checks that the service account and namespace informers have completed their initial sync.
+func cacheCheck(saCache *serviceAccountCache, nsCache *namespaceCache) healthCheck {
+	return healthCheck{name: "informers", check: func(context.Context) error {
+		if !saCache.hasSynced() {
+			return errors.New("service account cache not synced")
+		}
+		if !nsCache.hasSynced() {
+			return errors.New("namespace cache not synced")
+		}
+		return nil
+	}}
+}
+
+// certificateCheck checks that a serving certificate is loaded and remains valid for at least the margin.
+func certificateCheck(reloader *certReloader, margin time.Duration) healthCheck {
+	return healthCheck{name: "certificate", check: func(context.Context) error {
+		cert, err := reloader.GetCertificate(nil)
+		if err != nil {
+			return err
+		}
+		leaf := cert.Leaf
+		if leaf == nil {
+			if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+				return err
+			}
+		}
+		now := time.Now()
+		switch {
+		case now.Before(leaf.NotBefore):
+			return fmt.Errorf("certificate not valid before %s", leaf.NotBefore.UTC().Format(time.RFC3339))
+		case now.After(leaf.NotAfter):
+			return fmt.Errorf("certificate expired at %s", leaf.NotAfter.UTC().Format(time.RFC3339))
+		case now.Add(margin).After(leaf.NotAfter):
+			return fmt.Errorf("certificate expires at %s, within %s", leaf.NotAfter.UTC().Format(time.RFC3339), margin)
+		}
+		return nil
+	}}
+}
+
+// rolePolicyCheck checks that the role ARN policy is loaded.
+func rolePolicyCheck(watcher *rolePolicyWatcher) healthCheck {
+	return healthCheck{name: "role-policy", check: func(context.Context) error {
+		if watcher.current() == nil {
+			return errRolePolicyNotLoaded
+		}
+		return nil
+	}}
+}
+
+// readinessChecks returns the webhook readiness checks: not shutting down, API server reachable (or caches
+// synced, if used), serving certificate valid (if serving TLS) and configuration loaded.
+func (mw *mutatingWebhook) readinessChecks(reloader *certReloader, certExpiryMargin time.Duration) []healthCheck {
+	checks := []healthCheck{shutdownCheck()}
+	if mw.saCache != nil && mw.nsCache != nil {
+		checks = append(checks, cacheCheck(mw.saCache, mw.nsCache))
+	} else {
+		checks = append(checks, apiServerCheck(mw.k8sClient))
+	}
+	if reloader != nil {
+		checks = append(checks, certificateCheck(reloader, certExpiryMargin))
+	}
+	if mw.rolePolicy != nil {
+		checks = append(checks, rolePolicyCheck(mw.rolePolicy))
+	}
+	return checks
+}
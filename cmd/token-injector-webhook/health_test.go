@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/client-go/kubernetes"
+	fake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+func Test_healthHandler(t *testing.T) {
+	failing := healthCheck{name: "failing", check: func(context.Context) error { return errors.New("boom") }}
+	tests := []struct {
+		name       string
+		checks     []healthCheck
+		wantStatus int
+		want       healthResponse
+	}{
+		{
+			name:       "all checks pass",
+			checks:     []healthCheck{pingCheck(), shutdownCheck()},
+			wantStatus: http.StatusOK,
+			want: healthResponse{Status: healthStatusOK, Checks: []healthCheckResult{
+				{Name: "ping", Status: healthStatusOK},
+				{Name: "shutdown", Status: healthStatusOK},
+			}},
+		},
+		{
+			name:       "failing check",
+			checks:     []healthCheck{pingCheck(), failing},
+			wantStatus: http.StatusServiceUnavailable,
+			want: healthResponse{Status: healthStatusFailed, Checks: []healthCheckResult{
+				{Name: "ping", Status: healthStatusOK},
+				{Name: "failing", Status: healthStatusFailed, Error: "boom"},
+			}},
+		},
+		{
+			name:       "check with detail",
+			checks:     []healthCheck{{name: "config", check: pingCheck().check, detail: func() string { return "sha256:abc" }}},
+			wantStatus: http.StatusOK,
+			want: healthResponse{Status: healthStatusOK, Checks: []healthCheckResult{
+				{Name: "config", Status: healthStatusOK, Detail: "sha256:abc"},
+			}},
+		},
+		{
+			name:       "no checks",
+			wantStatus: http.StatusOK,
+			want:       healthResponse{Status: healthStatusOK, Checks: []healthCheckResult{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			healthHandler(time.Second, tt.checks...).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if rr.Code != tt.wantStatus {
+				t.Errorf("healthHandler() status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("healthHandler() Content-Type = %q, want application/json", ct)
+			}
+			var got healthResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+				t.Fatalf("healthHandler() invalid JSON response: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("healthHandler() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_shutdownCheck(t *testing.T) {
+	t.Cleanup(func() { draining.Store(false) })
+	if err := shutdownCheck().check(context.TODO()); err != nil {
+		t.Errorf("shutdownCheck() unexpected error = %v", err)
+	}
+	draining.Store(true)
+	if err := shutdownCheck().check(context.TODO()); err == nil {
+		t.Errorf("shutdownCheck() expected error while draining")
+	}
+}
+
+func Test_certificateCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		notBefore time.Duration
+		notAfter  time.Duration
+		noCert    bool
+		wantErr   bool
+	}{
+		{name: "valid", notBefore: -time.Hour, notAfter: 30 * 24 * time.Hour},
+		{name: "expiring within margin", notBefore: -time.Hour, notAfter: time.Hour, wantErr: true},
+		{name: "expired", notBefore: -2 * time.Hour, notAfter: -time.Hour, wantErr: true},
+		{name: "not yet valid", notBefore: time.Hour, notAfter: 30 * 24 * time.Hour, wantErr: true},
+		{name: "no certificate", noCert: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reloader := &certReloader{}
+			if !tt.noCert {
+				pair, err := generateKeyPair(&x509.Certificate{
+					Subject:   pkix.Name{CommonName: "token-injector-webhook"},
+					NotBefore: time.Now().Add(tt.notBefore),
+					NotAfter:  time.Now().Add(tt.notAfter),
+				}, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				cert, err := tls.X509KeyPair(pair.certPEM, pair.keyPEM)
+				if err != nil {
+					t.Fatal(err)
+				}
+				reloader.set(&cert)
+			}
+			err := certificateCheck(reloader, defaultCertExpiryMargin).check(context.TODO())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("certificateCheck() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_apiServerCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		hang    bool
+		wantErr bool
+	}{
+		{name: "reachable", status: http.StatusOK},
+		{name: "error", status: http.StatusServiceUnavailable, wantErr: true},
+		{name: "hanging", status: http.StatusOK, hang: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release := make(chan struct{})
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if tt.hang {
+					<-release
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(`{"major":"1","minor":"33"}`))
+			}))
+			defer srv.Close()
+			defer close(release)
+			client, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			if err = apiServerCheck(client).check(ctx); (err != nil) != tt.wantErr {
+				t.Errorf("apiServerCheck() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_rolePolicyCheck(t *testing.T) {
+	w := &rolePolicyWatcher{}
+	if err := rolePolicyCheck(w).check(context.TODO()); !errors.Is(err, errRolePolicyNotLoaded) {
+		t.Errorf("rolePolicyCheck() error = %v, want %v", err, errRolePolicyNotLoaded)
+	}
+	w.set(&rolePolicy{})
+	if err := rolePolicyCheck(w).check(context.TODO()); err != nil {
+		t.Errorf("rolePolicyCheck() unexpected error = %v", err)
+	}
+}
+
+func Test_mutatingWebhook_readinessChecks(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	tests := []struct {
+		name     string
+		mw       *mutatingWebhook
+		reloader *certReloader
+		want     []string
+	}{
+		{
+			name: "plain HTTP without cache",
+			mw:   &mutatingWebhook{k8sClient: client},
+			want: []string{"shutdown", "apiserver"},
+		},
+		{
+			name:     "TLS with cache and role policy",
+			mw:       &mutatingWebhook{k8sClient: client, saCache: &serviceAccountCache{}, nsCache: &namespaceCache{}, rolePolicy: &rolePolicyWatcher{}},
+			reloader: &certReloader{},
+			want:     []string{"shutdown", "informers", "certificate", "role-policy"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, c := range tt.mw.readinessChecks(tt.reloader, defaultCertExpiryMargin) {
+				got = append(got, c.name)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("mutatingWebhook.readinessChecks() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_cacheCheck_notSynced(t *testing.T) {
+	if err := cacheCheck(&serviceAccountCache{}, &namespaceCache{}).check(context.TODO()); err == nil {
+		t.Errorf("cacheCheck() expected error before the informers sync")
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// pod annotations overriding the token-injector containers resources and security context
+	injectorRequestsCPUKey            = "token-injector.io/injector-requests-cpu"
+	injectorRequestsMemoryKey         = "token-injector.io/injector-requests-memory"
+	injectorLimitsCPUKey              = "token-injector.io/injector-limits-cpu"
+	injectorLimitsMemoryKey           = "token-injector.io/injector-limits-memory"
+	injectorRunAsNonRootKey           = "token-injector.io/injector-run-as-non-root"
+	injectorRunAsUserKey              = "token-injector.io/injector-run-as-user"
+	injectorReadOnlyRootFilesystemKey = "token-injector.io/injector-read-only-root-filesystem"
+	injectorDropCapabilitiesKey       = "token-injector.io/injector-drop-capabilities"
+	injectorSeccompProfileKey         = "token-injector.io/injector-seccomp-profile"
+
+	// token-injector containers security context defaults, compliant with the restricted Pod Security Standard
+	defaultInjectorRunAsUser        = 65534
+	defaultInjectorDropCapabilities = "ALL"
+	defaultInjectorSeccompProfile   = string(corev1.SeccompProfileTypeRuntimeDefault)
+)
+
+// injectorSpec holds the resources and security context settings of the token-injector containers.
+type injectorSpec struct {
+	requestsCPU            string
+	requestsMemory         string
+	limitsCPU              string
+	limitsMemory           string
+	runAsNonRoot           bool
+	runAsUser              int64 // image user, if 0
+	readOnlyRootFilesystem bool
+	dropCapabilities       string // comma separated
+	seccompProfile         string // RuntimeDefault, Unconfined, Localhost/<profile> or empty
+}
+
+// defaultInjectorSpec returns the default token-injector containers settings.
+func defaultInjectorSpec() injectorSpec {
+	return injectorSpec{
+		requestsCPU:            requestsCPU,
+		requestsMemory:         requestsMemory,
+		limitsCPU:              limitsCPU,
+		limitsMemory:           limitsMemory,
+		runAsNonRoot:           true,
+		runAsUser:              defaultInjectorRunAsUser,
+		readOnlyRootFilesystem: true,
+		dropCapabilities:       defaultInjectorDropCapabilities,
+		seccompProfile:         defaultInjectorSeccompProfile,
+	}
+}
+
+// validate checks that all the settings are valid, and that the requests do not exceed the limits.
+func (s injectorSpec) validate() error {
+	if err := s.validateSettings(); err != nil {
+		return err
+	}
+	if err := validateRequestLimit(corev1.ResourceCPU, s.requestsCPU, s.limitsCPU); err != nil {
+		return err
+	}
+	return validateRequestLimit(corev1.ResourceMemory, s.requestsMemory, s.limitsMemory)
+}
+
+// validateSettings checks that each setting is valid on its own.
+func (s injectorSpec) validateSettings() error {
+	for _, q := range []string{s.requestsCPU, s.requestsMemory, s.limitsCPU, s.limitsMemory} {
+		if _, err := parseOptionalQuantity(q); err != nil {
+			return err
+		}
+	}
+	if s.runAsUser < 0 {
+		return fmt.Errorf("invalid run as user %d", s.runAsUser)
+	}
+	_, err := parseSeccompProfile(s.seccompProfile)
+	return err
+}
+
+// withOverrides returns the settings overridden by the pod or namespace annotations (scope); invalid
+// annotations are ignored and reported as warnings. The requests are checked against the limits once
+// all the annotations are applied, so that a request and its limit can be raised together; when a request
+// exceeds its limit, the request and limit annotations of the resource are ignored.
+func (s injectorSpec) withOverrides(annotations map[string]string, scope string) (injectorSpec, []string) {
+	var warnings []string
+	base := s
+	for key, value := range annotations {
+		override := s
+		var err error
+		switch key {
+		case injectorRequestsCPUKey:
+			override.requestsCPU = value
+		case injectorRequestsMemoryKey:
+			override.requestsMemory = value
+		case injectorLimitsCPUKey:
+			override.limitsCPU = value
+		case injectorLimitsMemoryKey:
+			override.limitsMemory = value
+		case injectorRunAsNonRootKey:
+			override.runAsNonRoot, err = strconv.ParseBool(value)
+		case injectorRunAsUserKey:
+			override.runAsUser, err = strconv.ParseInt(value, 10, 64)
+		case injectorReadOnlyRootFilesystemKey:
+			override.readOnlyRootFilesystem, err = strconv.ParseBool(value)
+		case injectorDropCapabilitiesKey:
+			override.dropCapabilities = value
+		case injectorSeccompProfileKey:
+			override.seccompProfile = value
+		default:
+			continue
+		}
+		if err == nil {
+			err = override.validateSettings()
+		}
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("token-injector: ignoring invalid %s %s annotation %q", scope, key, value))
+			continue
+		}
+		s = override
+	}
+	warnings = append(warnings, s.restoreExceededLimits(&base, annotations, scope)...)
+	return s, warnings
+}
+
+// restoreExceededLimits restores the base request and limit of the resources whose request exceeds the limit;
+// the annotations overriding them are reported as warnings.
+func (s *injectorSpec) restoreExceededLimits(base *injectorSpec, annotations map[string]string, scope string) []string {
+	var warnings []string
+	for _, r := range []struct {
+		name                   corev1.ResourceName
+		request, limit         *string
+		baseRequest, baseLimit string
+		requestKey, limitKey   string
+	}{
+		{corev1.ResourceCPU, &s.requestsCPU, &s.limitsCPU, base.requestsCPU, base.limitsCPU,
+			injectorRequestsCPUKey, injectorLimitsCPUKey},
+		{corev1.ResourceMemory, &s.requestsMemory, &s.limitsMemory, base.requestsMemory, base.limitsMemory,
+			injectorRequestsMemoryKey, injectorLimitsMemoryKey},
+	} {
+		err := validateRequestLimit(r.name, *r.request, *r.limit)
+		if err == nil {
+			continue
+		}
+		for _, key := range []string{r.requestKey, r.limitKey} {
+			if value, ok := annotations[key]; ok {
+				warnings = append(warnings, fmt.Sprintf("token-injector: ignoring invalid %s %s annotation %q: %s",
+					scope, key, value, err))
+			}
+		}
+		*r.request, *r.limit = r.baseRequest, r.baseLimit
+	}
+	return warnings
+}
+
+// validateRequestLimit checks that the resource request does not exceed its limit; an empty request or limit
+// is not checked.
+func validateRequestLimit(name corev1.ResourceName, request, limit string) error {
+	r, err := parseOptionalQuantity(request)
+	if err != nil || r == nil {
+		return err
+	}
+	l, err := parseOptionalQuantity(limit)
+	if err != nil || l == nil {
+		return err
+	}
+	if r.Cmp(*l) > 0 {
+		return fmt.Errorf("%s request %s exceeds the limit %s", name, request, limit)
+	}
+	return nil
+}
+
+// resources returns the token-injector containers resource requirements.
+func (s injectorSpec) resources() corev1.ResourceRequirements {
+	list := func(cpu, memory string) corev1.ResourceList {
+		l := corev1.ResourceList{}
+		if q, _ := parseOptionalQuantity(cpu); q != nil {
+			l[corev1.ResourceCPU] = *q
+		}
+		if q, _ := parseOptionalQuantity(memory); q != nil {
+			l[corev1.ResourceMemory] = *q
+		}
+		return l
+	}
+	return corev1.ResourceRequirements{
+		Requests: list(s.requestsCPU, s.requestsMemory),
+		Limits:   list(s.limitsCPU, s.limitsMemory),
+	}
+}
+
+// securityContext returns the token-injector containers security context.
+func (s injectorSpec) securityContext() *corev1.SecurityContext {
+	sc := &corev1.SecurityContext{
+		AllowPrivilegeEscalation: ptr.To(false),
+		RunAsNonRoot:             ptr.To(s.runAsNonRoot),
+		ReadOnlyRootFilesystem:   ptr.To(s.readOnlyRootFilesystem),
+	}
+	if s.runAsUser > 0 {
+		sc.RunAsUser = ptr.To(s.runAsUser)
+	}
+	for _, c := range strings.Split(s.dropCapabilities, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			if sc.Capabilities == nil {
+				sc.Capabilities = &corev1.Capabilities{}
+			}
+			sc.Capabilities.Drop = append(sc.Capabilities.Drop, corev1.Capability(c))
+		}
+	}
+	sc.SeccompProfile, _ = parseSeccompProfile(s.seccompProfile)
+	return sc
+}
+
+// parseOptionalQuantity parses a resource quantity; an empty value means no quantity.
+func parseOptionalQuantity(value string) (*resource.Quantity, error) {
+	if value == "" {
+		return nil, nil
+	}
+	q, err := resource.ParseQuantity(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid resource quantity %q: %w", value, err)
+	}
+	return &q, nil
+}
+
+// parseSeccompProfile parses a seccomp profile: RuntimeDefault, Unconfined or Localhost/<profile>;
+// an empty value means no profile.
+func parseSeccompProfile(value string) (*corev1.SeccompProfile, error) {
+	switch {
+	case value == "":
+		return nil, nil
+	case value == string(corev1.SeccompProfileTypeRuntimeDefault), value == string(corev1.SeccompProfileTypeUnconfined):
+		return &corev1.SeccompProfile{Type: corev1.SeccompProfileType(value)}, nil
+	case strings.HasPrefix(value, string(corev1.SeccompProfileTypeLocalhost)+"/") &&
+		len(value) > len(corev1.SeccompProfileTypeLocalhost)+1:
+		profile := strings.TrimPrefix(value, string(corev1.SeccompProfileTypeLocalhost)+"/")
+		return &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeLocalhost, LocalhostProfile: &profile}, nil
+	default:
+		return nil, fmt.Errorf("invalid seccomp profile %q: must be %s, %s or %s/<profile>", value,
+			corev1.SeccompProfileTypeRuntimeDefault, corev1.SeccompProfileTypeUnconfined, corev1.SeccompProfileTypeLocalhost)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func Test_injectorSpec_securityContext(t *testing.T) {
+	want := &corev1.SecurityContext{
+		AllowPrivilegeEscalation: ptr.To(false),
+		RunAsNonRoot:             ptr.To(true),
+		RunAsUser:                ptr.To(int64(defaultInjectorRunAsUser)),
+		ReadOnlyRootFilesystem:   ptr.To(true),
+		Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+		SeccompProfile:           &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+	}
+	if got := defaultInjectorSpec().securityContext(); !cmp.Equal(got, want) {
+		t.Errorf("injectorSpec.securityContext() diff %v", cmp.Diff(want, got))
+	}
+}
+
+//nolint:funlen
+func Test_injectorSpec_withOverrides(t *testing.T) {
+	tests := []struct {
+		name          string
+		annotations   map[string]string
+		wantResources corev1.ResourceRequirements
+		wantSC        func(sc *corev1.SecurityContext)
+		wantWarnings  int
+	}{
+		{
+			name: "no overrides",
+			wantResources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse(requestsCPU),
+					corev1.ResourceMemory: resource.MustParse(requestsMemory),
+				},
+				Limits: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse(limitsCPU),
+					corev1.ResourceMemory: resource.MustParse(limitsMemory),
+				},
+			},
+		},
+		{
+			name: "all overrides",
+			annotations: map[string]string{
+				injectorRequestsCPUKey:            "50m",
+				injectorRequestsMemoryKey:         "64Mi",
+				injectorLimitsCPUKey:              "",
+				injectorLimitsMemoryKey:           "64Mi",
+				injectorRunAsNonRootKey:           "false",
+				injectorRunAsUserKey:              "0",
+				injectorReadOnlyRootFilesystemKey: "false",
+				injectorDropCapabilitiesKey:       "NET_RAW, SYS_ADMIN",
+				injectorSeccompProfileKey:         "Localhost/profiles/token-injector.json",
+			},
+			wantResources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("50m"),
+					corev1.ResourceMemory: resource.MustParse("64Mi"),
+				},
+				Limits: corev1.ResourceList{
+					corev1.ResourceMemory: resource.MustParse("64Mi"),
+				},
+			},
+			wantSC: func(sc *corev1.SecurityContext) {
+				sc.RunAsNonRoot = ptr.To(false)
+				sc.RunAsUser = nil
+				sc.ReadOnlyRootFilesystem = ptr.To(false)
+				sc.Capabilities.Drop = []corev1.Capability{"NET_RAW", "SYS_ADMIN"}
+				sc.SeccompProfile = &corev1.SeccompProfile{
+					Type: corev1.SeccompProfileTypeLocalhost, LocalhostProfile: ptr.To("profiles/token-injector.json"),
+				}
+			},
+		},
+		{
+			name: "invalid overrides are ignored",
+			annotations: map[string]string{
+				injectorRequestsCPUKey:    "lots",
+				injectorRunAsUserKey:      "-1",
+				injectorRunAsNonRootKey:   "maybe",
+				injectorSeccompProfileKey: "Localhost/",
+			},
+			wantResources: defaultInjectorSpec().resources(),
+			wantWarnings:  4,
+		},
+		{
+			name:          "request above the limit is ignored",
+			annotations:   map[string]string{injectorRequestsCPUKey: "100m"},
+			wantResources: defaultInjectorSpec().resources(),
+			wantWarnings:  1,
+		},
+		{
+			name: "request raised with its limit",
+			annotations: map[string]string{
+				injectorRequestsCPUKey: "100m",
+				injectorLimitsCPUKey:   "200m",
+			},
+			wantResources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("100m"),
+					corev1.ResourceMemory: resource.MustParse(requestsMemory),
+				},
+				Limits: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("200m"),
+					corev1.ResourceMemory: resource.MustParse(limitsMemory),
+				},
+			},
+		},
+		{
+			name: "limit below the request is ignored with its request",
+			annotations: map[string]string{
+				injectorRequestsMemoryKey: "64Mi",
+				injectorLimitsMemoryKey:   "32Mi",
+				injectorRequestsCPUKey:    "5m",
+			},
+			wantResources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("5m"),
+					corev1.ResourceMemory: resource.MustParse(requestsMemory),
+				},
+				Limits: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse(limitsCPU),
+					corev1.ResourceMemory: resource.MustParse(limitsMemory),
+				},
+			},
+			wantWarnings: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			spec, warnings := defaultInjectorSpec().withOverrides(pod.GetAnnotations(), annotationScopePod)
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("injectorSpec.withOverrides() warnings = %v, want %d", warnings, tt.wantWarnings)
+			}
+			if got := spec.resources(); !cmp.Equal(got, tt.wantResources) {
+				t.Errorf("injectorSpec.resources() diff %v", cmp.Diff(tt.wantResources, got))
+			}
+			wantSC := defaultInjectorSpec().securityContext()
+			if tt.wantSC != nil {
+				tt.wantSC(wantSC)
+			}
+			if got := spec.securityContext(); !cmp.Equal(got, wantSC) {
+				t.Errorf("injectorSpec.securityContext() diff %v", cmp.Diff(wantSC, got))
+			}
+		})
+	}
+}
+
+func Test_injectorSpec_validate(t *testing.T) {
+	invalid := []func(s *injectorSpec){
+		func(s *injectorSpec) { s.limitsMemory = "50 MB" },
+		func(s *injectorSpec) { s.runAsUser = -1 },
+		func(s *injectorSpec) { s.seccompProfile = "Default" },
+		func(s *injectorSpec) { s.requestsCPU = "1" },
+	}
+	if err := defaultInjectorSpec().validate(); err != nil {
+		t.Errorf("injectorSpec.validate() unexpected error = %v", err)
+	}
+	for i, f := range invalid {
+		s := defaultInjectorSpec()
+		f(&s)
+		if err := s.validate(); err == nil {
+			t.Errorf("injectorSpec.validate() case %d expected error", i)
+		}
+	}
+}
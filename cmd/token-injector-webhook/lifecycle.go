@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// Job lifecycle modes; decide how the regular sidecar token refresh container exits with the workload of Job pods
+	jobLifecycleProcess = "process" // shared process namespace and termination file
+	jobLifecycleFile    = "file"    // termination file only
+	jobLifecycleNone    = "none"    // runs until the pod is deleted
+
+	// pod annotation overriding the Job lifecycle mode, e.g. set in the pod template of a Job opting into process mode
+	jobLifecycleKey = "token-injector.io/job-lifecycle"
+
+	// termination file, in the token volume, the workload may write when finished
+	terminationFileName = "terminated"
+)
+
+// validateJobLifecycle validates the job-lifecycle flag value.
+func validateJobLifecycle(mode string) error {
+	switch mode {
+	case jobLifecycleProcess, jobLifecycleFile, jobLifecycleNone:
+		return nil
+	default:
+		return fmt.Errorf("invalid job lifecycle %q: must be %q, %q or %q",
+			mode, jobLifecycleProcess, jobLifecycleFile, jobLifecycleNone)
+	}
+}
+
+// jobLifecycleMode returns the Job lifecycle mode of the pod: the pod annotation, if valid, or the configured default.
+func (mw *mutatingWebhook) jobLifecycleMode(pod *corev1.Pod) (string, []string) {
+	value, ok := pod.GetAnnotations()[jobLifecycleKey]
+	if !ok {
+		return mw.jobLifecycle, nil
+	}
+	if err := validateJobLifecycle(value); err != nil {
+		return mw.jobLifecycle, []string{fmt.Sprintf("token-injector: ignoring %s annotation: %s", jobLifecycleKey, err)}
+	}
+	return value, nil
+}
+
+// applyJobLifecycle makes the regular sidecar token refresh container of a Job pod exit with the workload, so
+// that the Job completes: it exits once the termination file is written to the token volume and, in process
+// mode, once the processes of the other containers have exited. The process namespace is shared, unless the
+// pod explicitly disables it. Invalid Job lifecycle annotations are returned as warnings.
+func (mw *mutatingWebhook) applyJobLifecycle(pod *corev1.Pod, sidecar *corev1.Container) []string {
+	if !ownedByJob(pod) {
+		return nil
+	}
+	mode, warnings := mw.jobLifecycleMode(pod)
+	if mode != jobLifecycleProcess && mode != jobLifecycleFile {
+		return warnings
+	}
+	sidecar.Command = append(sidecar.Command, fmt.Sprintf("--termination-file=%s/%s", mw.volumePath, terminationFileName))
+	if mode != jobLifecycleProcess {
+		return warnings
+	}
+	if pod.Spec.ShareProcessNamespace != nil && !*pod.Spec.ShareProcessNamespace {
+		logger.Debug("pod disables process namespace sharing, the sidecar exits on the termination file only")
+		return warnings
+	}
+	pod.Spec.ShareProcessNamespace = ptr.To(true)
+	sidecar.Command = append(sidecar.Command, "--exit-with-workload")
+	return warnings
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+//nolint:funlen
+func Test_mutatingWebhook_applyJobLifecycle(t *testing.T) {
+	jobOwner := []metav1.OwnerReference{{APIVersion: "batch/v1", Kind: "Job", Name: "test-job", Controller: ptr.To(true)}}
+	terminationFileArg := "--termination-file=" + tokenVolumePath + "/" + terminationFileName
+	tests := []struct {
+		name        string
+		mode        string
+		owners      []metav1.OwnerReference
+		annotations map[string]string
+		shareProcNS *bool
+		wantArgs    []string
+		wantShare   *bool
+		wantWarns   int
+	}{
+		{
+			name:     "not a job",
+			mode:     jobLifecycleProcess,
+			wantArgs: nil,
+		},
+		{
+			name:      "process",
+			mode:      jobLifecycleProcess,
+			owners:    jobOwner,
+			wantArgs:  []string{terminationFileArg, "--exit-with-workload"},
+			wantShare: ptr.To(true),
+		},
+		{
+			name:        "process namespace sharing disabled by the pod",
+			mode:        jobLifecycleProcess,
+			owners:      jobOwner,
+			shareProcNS: ptr.To(false),
+			wantArgs:    []string{terminationFileArg},
+			wantShare:   ptr.To(false),
+		},
+		{
+			name:     "file",
+			mode:     jobLifecycleFile,
+			owners:   jobOwner,
+			wantArgs: []string{terminationFileArg},
+		},
+		{
+			name:   "none",
+			mode:   jobLifecycleNone,
+			owners: jobOwner,
+		},
+		{
+			name:        "process opted in by the pod annotation",
+			mode:        jobLifecycleFile,
+			owners:      jobOwner,
+			annotations: map[string]string{jobLifecycleKey: jobLifecycleProcess},
+			wantArgs:    []string{terminationFileArg, "--exit-with-workload"},
+			wantShare:   ptr.To(true),
+		},
+		{
+			name:        "invalid pod annotation",
+			mode:        jobLifecycleFile,
+			owners:      jobOwner,
+			annotations: map[string]string{jobLifecycleKey: "pid"},
+			wantArgs:    []string{terminationFileArg},
+			wantWarns:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := &mutatingWebhook{volumePath: tokenVolumePath, jobLifecycle: tt.mode}
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{OwnerReferences: tt.owners, Annotations: tt.annotations},
+				Spec:       corev1.PodSpec{ShareProcessNamespace: tt.shareProcNS},
+			}
+			sidecar := getInjectorContainer(injectorSidecarContainerName, "image", "Always", tokenVolumeName,
+				tokenVolumePath, tokenFileName, true, defaultInjectorSpec())
+			baseArgs := len(sidecar.Command)
+			if warnings := mw.applyJobLifecycle(pod, &sidecar); len(warnings) != tt.wantWarns {
+				t.Errorf("applyJobLifecycle() warnings = %v, want %d", warnings, tt.wantWarns)
+			}
+			if got := sidecar.Command[baseArgs:]; (len(got) > 0 || len(tt.wantArgs) > 0) && !cmp.Equal(got, tt.wantArgs) {
+				t.Errorf("sidecar args diff %v", cmp.Diff(tt.wantArgs, got))
+			}
+			if !cmp.Equal(pod.Spec.ShareProcessNamespace, tt.wantShare) {
+				t.Errorf("shareProcessNamespace = %v, want %v", pod.Spec.ShareProcessNamespace, tt.wantShare)
+			}
+		})
+	}
+}
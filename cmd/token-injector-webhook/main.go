@@ -2,12 +2,16 @@ package main
 
 import (
 	"context"
+	"crypto/x509"
+	"errors"
 	"fmt"
-	"math/rand"
+	"math/rand/v2"
 	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -20,10 +24,11 @@ import (
 	wh "github.com/slok/kubewebhook/v2/pkg/webhook"
 	"github.com/slok/kubewebhook/v2/pkg/webhook/mutating"
 	"github.com/urfave/cli"
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	kubernetesConfig "sigs.k8s.io/controller-runtime/pkg/client/config"
 )
 
@@ -44,6 +49,24 @@ const (
 	awsWebIdentityTokenFile = "AWS_WEB_IDENTITY_TOKEN_FILE" // #nosec G101
 	awsRoleArn              = "AWS_ROLE_ARN"
 	awsRoleSessionName      = "AWS_ROLE_SESSION_NAME"
+
+	// names of the injected token-injector containers
+	injectorInitContainerName    = "generate-gcp-id-token"
+	injectorSidecarContainerName = "update-gcp-id-token"
+
+	// annotation recording the injection outcome on the pod
+	injectionStatusKey = "token-injector.io/injection-status"
+
+	// injection outcomes
+	injectionStatusInjected   = "injected"
+	injectionStatusReconciled = "reconciled"
+
+	// failure modes; decide what happens with a pod when the webhook is unable to mutate it
+	failureModeAllow = "allow"
+	failureModeDeny  = "deny"
+
+	// default timeout for Kubernetes API lookups done while handling a single admission request
+	defaultLookupTimeout = 5 * time.Second
 )
 
 var (
@@ -55,6 +78,7 @@ var (
 	testMode = false
 )
 
+// token-injector containers default resources
 const (
 	requestsCPU    = "5m"
 	requestsMemory = "10Mi"
@@ -63,12 +87,71 @@ const (
 )
 
 type mutatingWebhook struct {
-	k8sClient  kubernetes.Interface
-	image      string
-	pullPolicy string
-	volumeName string
-	volumePath string
-	tokenFile  string
+	k8sClient        kubernetes.Interface
+	image            string
+	pullPolicy       string
+	volumeName       string
+	volumePath       string
+	tokenFile        string
+	failureMode      string
+	conflictPolicy   string
+	lookupTimeout    time.Duration
+	saCache          *serviceAccountCache
+	nsCache          *namespaceCache
+	rolePolicy       *rolePolicyWatcher
+	rolePolicyAction string
+	// defaults of the AWS region and STS endpoint Service Account annotations
+	defaultRegion        string
+	stsRegionalEndpoints bool
+	sessionNamer         *sessionNamer
+	// token-injector containers resources and security context (defaultInjectorSpec, if nil)
+	injector *injectorSpec
+	// how the token refresh container is injected, and whether the cluster supports native sidecars
+	sidecarMode    string
+	nativeSidecars bool
+	// how the regular sidecar token refresh container exits with the workload of Job pods
+	jobLifecycle string
+	// placement of the injected init container (first, if empty)
+	initContainerPlacementDefault string
+	// service mesh annotations the metadata server address is added to
+	meshExcludeAnnotations []string
+	// recorder of the Events on the pod owners and Service Accounts (disabled, if nil)
+	events record.EventRecorder
+	// injection metrics (disabled, if nil)
+	metrics *injectionMetrics
+	// environment variables defaults added to the mutated containers
+	defaultEnv []corev1.EnvVar
+}
+
+// admissionDeniedError is returned by the pod mutator when the pod must be rejected.
+// It is translated into a denied admission response by deniedWebhook.
+type admissionDeniedError struct {
+	reason string
+}
+
+func (e *admissionDeniedError) Error() string {
+	return e.reason
+}
+
+// deniedWebhook wraps a mutating webhook and turns admissionDeniedError into a proper
+// "not allowed" admission response, so the pod is rejected with a clear message
+// regardless of the failurePolicy set on the MutatingWebhookConfiguration.
+type deniedWebhook struct {
+	wh.Webhook
+}
+
+// Review delegates to the wrapped webhook and converts admission denials into responses.
+func (d deniedWebhook) Review(ctx context.Context, ar whmodel.AdmissionReview) (whmodel.AdmissionResponse, error) {
+	res, err := d.Webhook.Review(ctx, ar)
+	var denied *admissionDeniedError
+	if errors.As(err, &denied) {
+		return &whmodel.ValidatingAdmissionResponse{
+			ID:      ar.ID,
+			Allowed: false,
+			Message: denied.reason,
+		}, nil
+	}
+	return res, err
 }
 
 var logger *log.Logger
@@ -82,11 +165,10 @@ func randomString(l int) string {
 	if testMode {
 		return strings.Repeat("0", l)
 	}
-	r := rand.New(rand.NewSource(time.Now().UnixNano())) // #nosec G404
 	bytes := make([]byte, l)
 	const letters = "abcdefghijklmnopqrstuvwxyz"
 	for i := range bytes {
-		bytes[i] = letters[r.Intn(len(letters))]
+		bytes[i] = letters[rand.IntN(len(letters))] // #nosec G404
 	}
 
 	return string(bytes)
@@ -105,37 +187,47 @@ func newK8SClient() (kubernetes.Interface, error) {
 
 // healthzHandler is an HTTP handler function that responds with a 200 OK status code.
 // This can be used as a health check endpoint to indicate that the service is running.
+// It responds with 503 Service Unavailable once the webhook is draining before shutdown.
 func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	if draining.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
 	w.WriteHeader(200)
 }
 
 // serveMetrics starts an HTTP server to serve Prometheus metrics at the specified address.
 // It sets up a new HTTP mux and registers the /metrics endpoint with the Prometheus HTTP handler.
-func serveMetrics(addr string) {
+// The returned server is shut down with the webhook server.
+func serveMetrics(addr string, timeouts serverTimeouts) *http.Server {
 	logger.Infof("Telemetry on http://%s", addr)
 
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", promhttp.Handler())
-	err := http.ListenAndServe(addr, mux) // #nosec G114
-	if err != nil {
-		logger.WithError(err).Fatal("error serving telemetry")
-	}
+	server := timeouts.server(addr, mux)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.WithError(err).Fatal("error serving telemetry")
+		}
+	}()
+	return server
 }
 
 // handlerFor creates an HTTP handler for the mutating webhook based on the provided configuration,
 // metrics recorder, and logger. It performs the following steps:
 // 1. Creates a new mutating webhook using the provided configuration.
 // 2. If an error occurs during the creation of the webhook, logs the error and terminates the program.
-// 3. Wraps the webhook with a metrics recorder to measure webhook performance.
-// 4. Creates an HTTP handler for the measured webhook, logging any errors that occur.
-// 5. Returns the configured HTTP handler.
+// 3. Wraps the webhook so admission denials are returned as rejected admission responses.
+// 4. Wraps the webhook with a metrics recorder to measure webhook performance.
+// 5. Creates an HTTP handler for the measured webhook, logging any errors that occur.
+// 6. Returns the configured HTTP handler.
 func handlerFor(config mutating.WebhookConfig, recorder wh.MetricsRecorder, logger *log.Logger) http.Handler {
 	webhook, err := mutating.NewWebhook(config)
 	if err != nil {
 		logger.WithError(err).Fatal("error creating webhook")
 	}
 
-	measuredWebhook := wh.NewMeasuredWebhook(recorder, webhook)
+	measuredWebhook := wh.NewMeasuredWebhook(recorder, deniedWebhook{webhook})
 
 	handler, err := whhttp.HandlerFor(whhttp.HandlerConfig{
 		Webhook: measuredWebhook,
@@ -148,94 +240,386 @@ func handlerFor(config mutating.WebhookConfig, recorder wh.MetricsRecorder, logg
 	return handler
 }
 
-// getAwsRoleArn retrieves the AWS role ARN from a Kubernetes ServiceAccount annotation.
-// It takes a context, service account name, and namespace as parameters.
-// It returns the role ARN and a boolean indicating whether the annotation was found.
-// On failure to fetch the ServiceAccount, it logs and exits via Fatalf.
-func (mw *mutatingWebhook) getAwsRoleArn(ctx context.Context, name, ns string) (string, bool) {
-	sa, err := mw.k8sClient.CoreV1().ServiceAccounts(ns).Get(ctx, name, metav1.GetOptions{})
+// lookupServiceAccount retrieves the Kubernetes ServiceAccount the pod runs under.
+// The lookup is bounded by the webhook lookup timeout; on failure the error is returned.
+func (mw *mutatingWebhook) lookupServiceAccount(ctx context.Context, name, ns string) (*corev1.ServiceAccount, error) {
+	if mw.lookupTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, mw.lookupTimeout)
+		defer cancel()
+	}
+	ctx, span := tracer.Start(ctx, spanServiceAccountLookup, trace.WithAttributes(
+		attrServiceAccount.String(name), attrNamespace.String(ns)))
+	start := time.Now()
+	sa, err := mw.getServiceAccount(ctx, name, ns)
+	mw.metrics.observeServiceAccountLookup(start, err)
+	endSpan(span, err)
 	if err != nil {
 		logger.WithFields(log.Fields{
 			"service account": name,
 			"namespace":       ns,
-		}).WithError(err).Fatalf("error getting service account")
+		}).WithError(err).Error("error getting service account")
+		return nil, fmt.Errorf("failed to get service account %s/%s: %w", ns, name, err)
+	}
+	return sa, nil
+}
+
+// lookupNamespace retrieves the Kubernetes Namespace of the pod.
+// The lookup is bounded by the webhook lookup timeout; on failure the error is returned.
+func (mw *mutatingWebhook) lookupNamespace(ctx context.Context, name string) (*corev1.Namespace, error) {
+	if mw.lookupTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, mw.lookupTimeout)
+		defer cancel()
+	}
+	var ns *corev1.Namespace
+	var err error
+	if mw.nsCache != nil {
+		ns, err = mw.nsCache.get(ctx, name)
+	} else {
+		ns, err = mw.k8sClient.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	}
+	if err != nil {
+		logger.WithField("namespace", name).WithError(err).Error("error getting namespace")
+		return nil, fmt.Errorf("failed to get namespace %s: %w", name, err)
 	}
-	roleArn, ok := sa.GetAnnotations()[awsRoleArnKey]
-	return roleArn, ok
+	return ns, nil
+}
+
+// namespaceGetter returns a getter looking the namespace up on first use only.
+func (mw *mutatingWebhook) namespaceGetter(ctx context.Context, name string) namespaceGetter {
+	var ns *corev1.Namespace
+	var err error
+	var done bool
+	return func() (*corev1.Namespace, error) {
+		if !done {
+			ns, err = mw.lookupNamespace(ctx, name)
+			done = true
+		}
+		return ns, err
+	}
+}
+
+// getServiceAccount returns the ServiceAccount from the informer cache, if enabled, or directly from the API server.
+func (mw *mutatingWebhook) getServiceAccount(ctx context.Context, name, ns string) (*corev1.ServiceAccount, error) {
+	if mw.saCache != nil {
+		return mw.saCache.get(ctx, name, ns)
+	}
+	return mw.k8sClient.CoreV1().ServiceAccounts(ns).Get(ctx, name, metav1.GetOptions{})
 }
 
 // mutateContainers modifies the given list of containers.
-// For each container in the list, the function does the following:
+// For each container in the list (except the injected token-injector containers), the function does the following:
 // 1. Adds a volume mount for the token with the name and path specified in the mutatingWebhook struct.
-// 2. Adds environment variables for AWS Web Identity Token file, role ARN, and a unique session name.
-func (mw *mutatingWebhook) mutateContainers(containers []corev1.Container, roleArn string) bool {
-	if len(containers) == 0 {
-		return false
-	}
+// 2. Adds environment variables for AWS Web Identity Token file, role ARN, and the pod session name.
+// 3. Adds the default environment variables (the AWS region and STS endpoint, and the configured env
+// defaults) it does not define yet.
+// Only containers chosen by the container selector are mutated. Mounts and environment variables
+// already defined in a container are merged by the merger, according to its conflict policy.
+func (mw *mutatingWebhook) mutateContainers(containers []corev1.Container, roleArn string, defaultEnv []corev1.EnvVar,
+	session sessionNameData, sel containerSelector, m *merger) (bool, error) {
+	mutated := false
 	for i, container := range containers {
+		if isInjectorContainer(container.Name) || !sel.selected(container.Name) {
+			continue
+		}
+		sessionName, err := mw.sessionName(session, container.Name)
+		if err != nil {
+			return false, err
+		}
 		// add token volume mount
-		container.VolumeMounts = append(container.VolumeMounts, []corev1.VolumeMount{
-			{
-				Name:      mw.volumeName,
-				MountPath: mw.volumePath,
-			},
-		}...)
+		container.VolumeMounts, err = m.mount(container.Name, container.VolumeMounts, corev1.VolumeMount{
+			Name:      mw.volumeName,
+			MountPath: mw.volumePath,
+		})
+		if err != nil {
+			return false, err
+		}
 		// add AWS Web Identity Token environment variables to container
-		container.Env = append(container.Env, []corev1.EnvVar{
-			{
-				Name:  awsWebIdentityTokenFile,
-				Value: fmt.Sprintf("%s/%s", mw.volumePath, mw.tokenFile),
-			},
-			{
-				Name:  awsRoleArn,
-				Value: roleArn,
-			},
-			{
-				Name:  awsRoleSessionName,
-				Value: fmt.Sprintf("token-injector-webhook-%s", randomString(16)),
-			},
-		}...)
+		for _, v := range []struct {
+			env     corev1.EnvVar
+			keepOwn bool
+		}{
+			{env: corev1.EnvVar{Name: awsWebIdentityTokenFile, Value: fmt.Sprintf("%s/%s", mw.volumePath, mw.tokenFile)}},
+			{env: corev1.EnvVar{Name: awsRoleArn, Value: roleArn}},
+			{env: corev1.EnvVar{Name: awsRoleSessionName, Value: sessionName}, keepOwn: true},
+		} {
+			container.Env, err = m.env(container.Name, container.Env, v.env, v.keepOwn)
+			if err != nil {
+				return false, err
+			}
+		}
+		// add default environment variables, values defined in the container win
+		for _, v := range defaultEnv {
+			container.Env = upsertEnvVar(container.Env, v, true)
+		}
 		// update containers
 		containers[i] = container
+		mutated = true
 	}
-	return true
+	return mutated, nil
 }
 
-func (mw *mutatingWebhook) mutatePod(ctx context.Context, pod *corev1.Pod, ns string, dryRun bool) {
-	// get service account AWS Role ARN annotation
-	roleArn, ok := mw.getAwsRoleArn(ctx, pod.Spec.ServiceAccountName, ns)
-	if !ok {
-		logger.Debug("skipping pods with Service Account without AWS Role ARN annotation")
-		return
+// mutatePod injects the token-injector containers, volume and AWS environment into the pod.
+// Pods without the opt-in label, opted out by annotation, or without an AWS Role ARN
+// (see resolveRoleArn) are skipped, and the skip reason is recorded on the pod. Role ARNs not allowed
+// by the role ARN policy, if enabled, are denied or skipped depending on the role policy action.
+// The namespace annotations override the global injection settings (see withNamespaceDefaults).
+// The mutation is idempotent: objects injected by a previous invocation are reconciled by name,
+// and the outcome is recorded in the injection status annotation. Conflicts with user defined
+// env vars, volumes and mounts are resolved by the conflict policy and reported as warnings.
+// It returns an error when the pod could not be mutated; the pod is left untouched in that case.
+func (mw *mutatingWebhook) mutatePod(ctx context.Context, pod *corev1.Pod, ns string, dryRun bool) (
+	warnings []string, err error) {
+	sa, getNamespace, err := mw.evaluateOptOut(ctx, pod, ns)
+	if err != nil || sa == nil {
+		return nil, err
+	}
+	roleArn, arn, roleSource, policyWarnings, err := mw.evaluateRoleArn(ctx, pod, sa, ns, getNamespace, dryRun)
+	if err != nil || arn == nil {
+		return policyWarnings, err
+	}
+	_, span := tracer.Start(ctx, spanPatchGeneration)
+	defer func() { endSpan(span, err) }()
+	namespace, err := getNamespace()
+	if err != nil {
+		return nil, err
+	}
+	in := mw.newPodInjection(pod, namespace, sa, roleArn, arn, roleSource)
+	mutated, err := in.mutateContainers()
+	if err != nil {
+		return in.merger.warnings, err
+	}
+	// inject token-injector containers and volume only if at least one container was selected
+	if !mutated {
+		skipPod(pod, skipReasonNoContainersSelected)
+		return in.merger.warnings, nil
+	}
+	if dryRun {
+		return in.merger.warnings, nil
 	}
+	injected, err := in.injectContainers()
+	if err != nil {
+		return in.merger.warnings, err
+	}
+	containers, err := in.injectVolume(injected)
+	if err != nil {
+		return in.merger.warnings, err
+	}
+	span.SetAttributes(attrMutatedContainer.StringSlice(containers))
+	mw.metrics.observeInjection(arn, len(containers))
+	return in.merger.warnings, nil
+}
+
+// evaluateOptOut evaluates the opt-in label and the pod, Service Account and Namespace opt-out annotations.
+// It returns the pod Service Account and the Namespace getter; a nil Service Account without error means
+// the pod is skipped, and the skip reason is recorded on the pod.
+func (mw *mutatingWebhook) evaluateOptOut(ctx context.Context, pod *corev1.Pod, ns string) (
+	*corev1.ServiceAccount, namespaceGetter, error) {
+	// evaluate the opt-in label and the pod opt-out annotation
+	reason, decided := podSkipReason(pod)
+	if reason != "" {
+		skipPod(pod, reason)
+		return nil, nil, nil
+	}
+	sa, err := mw.lookupServiceAccount(ctx, pod.Spec.ServiceAccountName, ns)
+	if err != nil {
+		return nil, nil, err
+	}
+	getNamespace := mw.namespaceGetter(ctx, ns)
+	// evaluate the ServiceAccount and Namespace opt-out annotations
+	if !decided {
+		if reason, err = scopeSkipReason(sa, getNamespace); err != nil {
+			return nil, nil, err
+		}
+		if reason != "" {
+			skipPod(pod, reason)
+			return nil, nil, nil
+		}
+	}
+	return sa, getNamespace, nil
+}
+
+// podInjection holds the state of a single pod mutation shared by the injection steps.
+type podInjection struct {
+	// scoped is the webhook with the namespace injection defaults applied
+	scoped          *mutatingWebhook
+	pod             *corev1.Pod
+	namespace       *corev1.Namespace
+	roleArn         string
+	roleSource      string
+	env             []corev1.EnvVar
+	session         sessionNameData
+	sel             containerSelector
+	spec            injectorSpec
+	merger          *merger
+	alreadyInjected bool
+}
+
+// newPodInjection merges the namespace injection defaults with the global settings and evaluates
+// the pod annotations selecting the containers and overriding the injector spec.
+func (mw *mutatingWebhook) newPodInjection(pod *corev1.Pod, namespace *corev1.Namespace, sa *corev1.ServiceAccount,
+	roleArn string, arn *roleARN, roleSource string) *podInjection {
+	scoped, nsWarnings := mw.withNamespaceDefaults(namespace)
+	in := &podInjection{
+		scoped:          scoped,
+		pod:             pod,
+		namespace:       namespace,
+		roleArn:         roleArn,
+		roleSource:      roleSource,
+		env:             append(scoped.regionEnv(sa, arn), mw.defaultEnv...),
+		session:         newSessionNameData(pod, namespace.GetName(), sa.GetName()),
+		alreadyInjected: mw.isInjected(pod),
+	}
+	in.merger = newMerger(pod, mw.conflictPolicy, in.alreadyInjected)
+	in.merger.warnings = append(in.merger.warnings, nsWarnings...)
+	var warnings []string
+	in.sel, warnings = newContainerSelector(pod)
+	in.merger.warnings = append(in.merger.warnings, warnings...)
+	in.spec, warnings = scoped.injector.withOverrides(pod.GetAnnotations(), annotationScopePod)
+	in.merger.warnings = append(in.merger.warnings, warnings...)
+	return in
+}
+
+// mutateContainers adds the token mount and AWS environment to the selected init containers and containers.
+// It reports whether at least one container was mutated.
+func (in *podInjection) mutateContainers() (bool, error) {
 	// mutate Pod init containers
-	initContainersMutated := mw.mutateContainers(pod.Spec.InitContainers, roleArn)
+	initContainersMutated, err := in.scoped.mutateContainers(in.pod.Spec.InitContainers, in.roleArn, in.env,
+		in.session, in.sel, in.merger)
+	if err != nil {
+		return false, err
+	}
 	if initContainersMutated {
 		logger.Debug("successfully mutated pod init containers")
 	} else {
 		logger.Debug("no pod init containers were mutated")
 	}
 	// mutate Pod containers
-	containersMutated := mw.mutateContainers(pod.Spec.Containers, roleArn)
+	containersMutated, err := in.scoped.mutateContainers(in.pod.Spec.Containers, in.roleArn, in.env,
+		in.session, in.sel, in.merger)
+	if err != nil {
+		return false, err
+	}
 	if containersMutated {
 		logger.Debug("successfully mutated pod containers")
 	} else {
 		logger.Debug("no pod containers were mutated")
 	}
+	return initContainersMutated || containersMutated, nil
+}
 
-	if (initContainersMutated || containersMutated) && !dryRun {
-		// prepend token-injector init container (as first in it container)
-		pod.Spec.InitContainers = append([]corev1.Container{getInjectorContainer("generate-gcp-id-token",
-			mw.image, mw.pullPolicy, mw.volumeName, mw.volumePath, mw.tokenFile, false)}, pod.Spec.InitContainers...)
-		logger.Debug("successfully prepended pod init containers to spec")
-		// append sidekick token-injector update container (as last container)
-		pod.Spec.Containers = append(pod.Spec.Containers, getInjectorContainer("update-gcp-id-token",
-			mw.image, mw.pullPolicy, mw.volumeName, mw.volumePath, mw.tokenFile, true))
-		logger.Debug("successfully prepended pod sidecar container to spec")
-		// append empty token-injector volume
-		pod.Spec.Volumes = append(pod.Spec.Volumes, getInjectorVolume(mw.volumeName))
-		logger.Debug("successfully appended pod spec volumes")
+// injectContainers adds the token-injector containers to the pod, as a native sidecar or as an init container
+// and a sidecar container, after checking them against the namespace Pod Security Admission levels.
+// It returns the injected containers.
+func (in *podInjection) injectContainers() ([]*corev1.Container, error) {
+	mw, pod := in.scoped, in.pod
+	native := mw.useNativeSidecar(pod)
+	var injected []*corev1.Container
+	var initContainer, sidecar corev1.Container
+	if native {
+		sidecar = getNativeSidecarContainer(mw.image, mw.pullPolicy, mw.volumeName, mw.volumePath, mw.tokenFile, in.spec)
+		injected = []*corev1.Container{&sidecar}
+	} else {
+		initContainer = getInjectorContainer(injectorInitContainerName,
+			mw.image, mw.pullPolicy, mw.volumeName, mw.volumePath, mw.tokenFile, false, in.spec)
+		sidecar = getInjectorContainer(injectorSidecarContainerName,
+			mw.image, mw.pullPolicy, mw.volumeName, mw.volumePath, mw.tokenFile, true, in.spec)
+		in.merger.warnings = append(in.merger.warnings, mw.applyJobLifecycle(pod, &sidecar)...)
+		injected = []*corev1.Container{&initContainer, &sidecar}
 	}
+	// check the token-injector containers against the namespace Pod Security Admission levels
+	warnings, err := checkPodSecurity(in.namespace, pod, injected...)
+	in.merger.warnings = append(in.merger.warnings, warnings...)
+	if err != nil {
+		return nil, err
+	}
+	placement, warnings := mw.initContainerPlacement(pod)
+	in.merger.warnings = append(in.merger.warnings, warnings...)
+	if native {
+		warnings = injectNativeSidecar(pod, sidecar, placement)
+	} else {
+		warnings = injectSidecarContainer(pod, initContainer, sidecar, placement)
+	}
+	in.merger.warnings = append(in.merger.warnings, warnings...)
+	mw.excludeMetadataServer(pod)
+	return injected, nil
+}
+
+// injectVolume adds the token-injector volume to the pod and records the injection status and audit annotations.
+// It returns the names of the mutated containers.
+func (in *podInjection) injectVolume(injected []*corev1.Container) ([]string, error) {
+	pod := in.pod
+	// empty token-injector volume
+	volume := getInjectorVolume(in.scoped.volumeName)
+	var err error
+	if pod.Spec.Volumes, err = in.merger.volume(pod.Spec.Volumes, volume); err != nil {
+		return nil, err
+	}
+	logger.Debug("successfully added pod spec volumes")
+	// record injection outcome
+	status := injectionStatusInjected
+	if in.alreadyInjected {
+		status = injectionStatusReconciled
+	}
+	setAnnotation(pod, injectionStatusKey, status)
+	delete(pod.Annotations, skipReasonKey)
+	config := appliedConfig{RoleArn: in.roleArn, Env: in.env, Volume: volume}
+	for _, c := range injected {
+		config.Containers = append(config.Containers, *c)
+	}
+	configHash, err := config.hash()
+	if err != nil {
+		return nil, err
+	}
+	containers := mutatedContainers(pod, in.sel)
+	auditInjection(pod, in.scoped.image, in.roleSource, containers, configHash)
+	return containers, nil
+}
+
+// evaluateRoleArn resolves the AWS Role ARN from the pod, Service Account or Namespace annotations, validates
+// it and enforces the cluster-wide role ARN policy. A nil role ARN without error means the pod is skipped.
+func (mw *mutatingWebhook) evaluateRoleArn(ctx context.Context, pod *corev1.Pod, sa *corev1.ServiceAccount, ns string,
+	getNamespace namespaceGetter, dryRun bool) (roleArn string, arn *roleARN, roleSource string, warnings []string, err error) {
+	_, span := tracer.Start(ctx, spanPolicyEvaluation)
+	defer func() {
+		span.SetAttributes(attrRoleArnSource.String(roleSource))
+		endSpan(span, err)
+	}()
+	if roleArn, roleSource, err = resolveRoleArn(pod, sa, getNamespace); err != nil {
+		return "", nil, roleSource, nil, err
+	}
+	if roleArn == "" {
+		logger.Debug("skipping pods without AWS Role ARN annotation")
+		skipPod(pod, skipReasonNoRoleArn)
+		return "", nil, roleSource, nil, nil
+	}
+	logger.WithFields(log.Fields{"role arn": roleArn, "source": roleSource}).Debug("resolved AWS Role ARN")
+	if arn, err = parseRoleArn(roleArn); err != nil {
+		if roleSource == roleSourceServiceAccount && !dryRun {
+			mw.recordServiceAccountEvent(sa, eventReasonInvalidRoleArn, fmt.Sprintf("invalid %s annotation: %s", awsRoleArnKey, err))
+		}
+		return "", nil, roleSource, nil, fmt.Errorf("%s annotation: %w", roleSource, err)
+	}
+	// enforce the cluster-wide role ARN policy
+	allowed, warnings, err := mw.enforceRolePolicy(pod, arn, getNamespace)
+	if err != nil || !allowed {
+		var denied *admissionDeniedError
+		if roleSource == roleSourceServiceAccount && !dryRun && (err == nil || errors.As(err, &denied)) {
+			mw.recordServiceAccountEvent(sa, eventReasonRoleArnNotAllowed,
+				fmt.Sprintf("role ARN %q is not allowed in namespace %q by the role ARN policy", roleArn, ns))
+		}
+		return "", nil, roleSource, warnings, err
+	}
+	return roleArn, arn, roleSource, nil, nil
+}
+
+// setAnnotation sets the annotation on the pod, initializing the annotations map if needed.
+func setAnnotation(pod *corev1.Pod, key, value string) {
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[key] = value
 }
 
 // getInjectorVolume creates and returns a Kubernetes Volume object configured as an in-memory EmptyDir volume.
@@ -253,9 +637,10 @@ func getInjectorVolume(volumeName string) corev1.Volume {
 }
 
 // getInjectorContainer creates and returns a Kubernetes container configuration for the token-injector container.
-// The container runs the token-injector command with specified parameters and mounts a volume for token storage.
+// The container runs the token-injector command with specified parameters and mounts a volume for token storage;
+// its resources and security context come from the injector spec.
 func getInjectorContainer(name, image, pullPolicy, volumeName, volumePath, tokenFile string,
-	refresh bool) corev1.Container {
+	refresh bool, spec injectorSpec) corev1.Container {
 	return corev1.Container{
 		Name:            name,
 		Image:           image,
@@ -271,16 +656,8 @@ func getInjectorContainer(name, image, pullPolicy, volumeName, volumePath, token
 				MountPath: volumePath,
 			},
 		},
-		Resources: corev1.ResourceRequirements{
-			Requests: corev1.ResourceList{
-				corev1.ResourceCPU:    resource.MustParse(requestsCPU),
-				corev1.ResourceMemory: resource.MustParse(requestsMemory),
-			},
-			Limits: corev1.ResourceList{
-				corev1.ResourceCPU:    resource.MustParse(limitsCPU),
-				corev1.ResourceMemory: resource.MustParse(limitsMemory),
-			},
-		},
+		Resources:       spec.resources(),
+		SecurityContext: spec.securityContext(),
 	}
 }
 
@@ -323,37 +700,219 @@ func (mw *mutatingWebhook) podMutator(
 ) (*mutating.MutatorResult, error) {
 	switch v := obj.(type) {
 	case *corev1.Pod:
-		mw.mutatePod(ctx, v, ar.Namespace, ar.DryRun)
-		return &mutating.MutatorResult{MutatedObject: v}, nil
+		// mutate a copy, so a failed mutation never leaks a half-mutated pod
+		pod := v.DeepCopy()
+		warnings, err := mw.mutatePod(ctx, pod, ar.Namespace, ar.DryRun)
+		span := trace.SpanFromContext(ctx)
+		span.SetAttributes(attrNamespace.String(ar.Namespace), attrPodGenerateName.String(pod.GetGenerateName()),
+			attrOutcome.String(mutationOutcome(pod, err)))
+		if err != nil {
+			span.RecordError(err)
+		}
+		if !ar.DryRun {
+			mw.recordOwnerEvent(pod, ar.Namespace, err)
+			mw.metrics.observeMutation(ar.Namespace, pod, err)
+		}
+		if err != nil {
+			return mw.handleMutationError(v, err)
+		}
+		return &mutating.MutatorResult{MutatedObject: pod, Warnings: warnings}, nil
 	default:
 		return &mutating.MutatorResult{}, nil
 	}
 }
 
-// mutation webhook server
-func runWebhook(c *cli.Context) error {
-	k8sClient, err := newK8SClient()
+// handleMutationError applies the webhook failure mode to a pod that could not be mutated.
+// Explicit admission denials (e.g. from the conflict policy) always reject the pod.
+// In "deny" mode the pod is rejected; otherwise it is admitted unmutated with an admission warning.
+func (mw *mutatingWebhook) handleMutationError(pod *corev1.Pod, err error) (*mutating.MutatorResult, error) {
+	logger.WithFields(log.Fields{
+		"pod":          pod.GetName(),
+		"generateName": pod.GetGenerateName(),
+		"failure mode": mw.failureMode,
+	}).WithError(err).Warn("failed to mutate pod")
+	var denied *admissionDeniedError
+	if errors.As(err, &denied) {
+		return nil, err
+	}
+	if mw.failureMode == failureModeDeny {
+		return nil, &admissionDeniedError{
+			reason: fmt.Sprintf("token-injector: pod rejected, AWS credentials could not be injected: %s", err),
+		}
+	}
+	return &mutating.MutatorResult{
+		MutatedObject: pod,
+		Warnings: []string{
+			fmt.Sprintf("token-injector: pod admitted without AWS credentials injection: %s", err),
+		},
+	}, nil
+}
+
+// validatePullPolicy checks that the image pull policy is empty or one of the supported values.
+func validatePullPolicy(policy string) error {
+	switch corev1.PullPolicy(policy) {
+	case corev1.PullAlways, corev1.PullIfNotPresent, corev1.PullNever, "":
+		return nil
+	default:
+		return fmt.Errorf("invalid pull policy %q: must be %s, %s or %s", policy,
+			corev1.PullAlways, corev1.PullIfNotPresent, corev1.PullNever)
+	}
+}
+
+// validateFailureMode checks that the failure mode is one of the supported values.
+func validateFailureMode(mode string) error {
+	switch mode {
+	case failureModeAllow, failureModeDeny:
+		return nil
+	default:
+		return fmt.Errorf("invalid failure mode %q: must be %q or %q", mode, failureModeAllow, failureModeDeny)
+	}
+}
+
+// validateModes checks the failure, conflict, role policy, sidecar, Job lifecycle and placement mode flags.
+func validateModes(c *cli.Context) error {
+	for _, validate := range []func() error{
+		func() error { return validateFailureMode(c.String("failure-mode")) },
+		func() error { return validateConflictPolicy(c.String("conflict-policy")) },
+		func() error { return validateRolePolicyAction(c.String("role-policy-action")) },
+		func() error { return validateSidecarMode(c.String("sidecar-mode")) },
+		func() error { return validateJobLifecycle(c.String("job-lifecycle")) },
+		func() error { return validatePlacement(c.String("init-container-placement")) },
+	} {
+		if err := validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serverTLSOptions holds the webhook server TLS settings parsed from the flags.
+type serverTLSOptions struct {
+	minVersion   uint16
+	cipherSuites []uint16
+	clientCAs    *x509.CertPool
+}
+
+// parseServerTLSOptions parses the TLS version, cipher suites and client CA flags.
+// Client certificate verification requires TLS, static or self-managed.
+func parseServerTLSOptions(c *cli.Context) (opts serverTLSOptions, err error) {
+	if opts.minVersion, err = parseTLSVersion(c.String("tls-min-version")); err != nil {
+		return opts, err
+	}
+	if opts.cipherSuites, err = parseCipherSuites(parseList(c.String("tls-cipher-suites"))); err != nil {
+		return opts, err
+	}
+	if file := c.String("client-ca-file"); file != "" {
+		if !c.Bool("tls-self-managed") && c.String("tls-cert-file") == "" {
+			return opts, errors.New("client certificate verification requires TLS")
+		}
+		if opts.clientCAs, err = loadClientCAs(file); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+// newMutatingWebhook creates the mutating webhook from the flags, with its event recorder and injection metrics.
+func newMutatingWebhook(c *cli.Context, k8sClient kubernetes.Interface) (*mutatingWebhook, error) {
+	sessionNamer, err := newSessionNamer(c.String("session-name-template"))
 	if err != nil {
-		logger.WithError(err).Fatal("error creating k8s client")
+		return nil, err
+	}
+	injector := injectorSpec{
+		requestsCPU:            c.String("injector-requests-cpu"),
+		requestsMemory:         c.String("injector-requests-memory"),
+		limitsCPU:              c.String("injector-limits-cpu"),
+		limitsMemory:           c.String("injector-limits-memory"),
+		runAsNonRoot:           c.BoolT("injector-run-as-non-root"),
+		runAsUser:              c.Int64("injector-run-as-user"),
+		readOnlyRootFilesystem: c.BoolT("injector-read-only-root-filesystem"),
+		dropCapabilities:       c.String("injector-drop-capabilities"),
+		seccompProfile:         c.String("injector-seccomp-profile"),
+	}
+	if err = injector.validate(); err != nil {
+		return nil, err
 	}
+	webhook := &mutatingWebhook{
+		k8sClient:                     k8sClient,
+		image:                         c.String("image"),
+		pullPolicy:                    c.String("pull-policy"),
+		volumeName:                    c.String("volume-name"),
+		volumePath:                    c.String("volume-path"),
+		tokenFile:                     c.String("token-file"),
+		failureMode:                   c.String("failure-mode"),
+		conflictPolicy:                c.String("conflict-policy"),
+		lookupTimeout:                 c.Duration("lookup-timeout"),
+		rolePolicyAction:              c.String("role-policy-action"),
+		defaultRegion:                 c.String("aws-default-region"),
+		stsRegionalEndpoints:          c.Bool("sts-regional-endpoints"),
+		sessionNamer:                  sessionNamer,
+		injector:                      &injector,
+		sidecarMode:                   c.String("sidecar-mode"),
+		jobLifecycle:                  c.String("job-lifecycle"),
+		initContainerPlacementDefault: c.String("init-container-placement"),
+		meshExcludeAnnotations:        parseList(c.String("mesh-exclude-annotations")),
+	}
+	if c.BoolT("events") {
+		webhook.events = newEventRecorder(k8sClient, float32(c.Float64("events-qps")), c.Int("events-burst"))
+	}
+	if webhook.sidecarMode == sidecarModeAuto {
+		if webhook.nativeSidecars, err = nativeSidecarsSupported(k8sClient); err != nil {
+			logger.WithError(err).Warn("error detecting native sidecars support, using regular sidecar containers")
+		}
+		logger.WithField("native sidecars", webhook.nativeSidecars).Info("detected native sidecars support")
+	}
+	webhook.metrics, err = newInjectionMetrics(prometheus.DefaultRegisterer, c.String("metrics-account-id-labels"))
+	if err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
 
-	webhook := mutatingWebhook{
-		k8sClient:  k8sClient,
-		image:      c.String("image"),
-		pullPolicy: c.String("pull-policy"),
-		volumeName: c.String("volume-name"),
-		volumePath: c.String("volume-path"),
-		tokenFile:  c.String("token-file"),
+// startInformers starts the Service Account and Namespace caches and the role ARN policy watcher, if enabled.
+func (mw *mutatingWebhook) startInformers(c *cli.Context) error {
+	var err error
+	if c.BoolT("sa-cache") {
+		var saCacheMetrics *cacheMetrics
+		saCacheMetrics, err = newCacheMetrics(prometheus.DefaultRegisterer)
+		if err != nil {
+			logger.WithError(err).Fatalf("error creating service account cache metrics")
+		}
+		mw.saCache, err = newServiceAccountCache(mw.k8sClient, c.String("sa-cache-namespace-selector"),
+			c.Duration("sa-cache-resync"), saCacheMetrics)
+		if err != nil {
+			return err
+		}
+		if err = mw.saCache.start(make(chan struct{})); err != nil {
+			logger.WithError(err).Fatalf("error starting service account cache")
+		}
+		mw.nsCache = newNamespaceCache(mw.k8sClient, c.Duration("sa-cache-resync"))
+		if err = mw.nsCache.start(make(chan struct{})); err != nil {
+			logger.WithError(err).Fatalf("error starting namespace cache")
+		}
 	}
+	if ref := c.String("role-policy-configmap"); ref != "" {
+		mw.rolePolicy, err = newRolePolicyWatcher(mw.k8sClient, ref, defaultCacheResync, prometheus.DefaultRegisterer)
+		if err != nil {
+			return err
+		}
+		if err = mw.rolePolicy.start(make(chan struct{})); err != nil {
+			logger.WithError(err).Fatalf("error starting role policy watcher")
+		}
+	}
+	return nil
+}
 
-	mutator := mutating.MutatorFunc(webhook.podMutator)
+// newPodHandler creates the admission handler of the pods, verifying the client certificates if a client CA
+// is configured and tracing the admission reviews if a tracing endpoint is configured.
+// The returned function flushes the pending traces.
+func newPodHandler(c *cli.Context, mutator mutating.Mutator, verifyClientCert bool) (http.Handler, func(), error) {
 	metricsRecorder, err := metrics.NewRecorder(metrics.RecorderConfig{
 		Registry: prometheus.DefaultRegisterer,
 	})
 	if err != nil {
 		logger.WithError(err).Fatalf("error creating metrics recorder")
 	}
-
 	podHandler := handlerFor(
 		mutating.WebhookConfig{
 			ID:      "init-token-injector-pods",
@@ -364,30 +923,145 @@ func runWebhook(c *cli.Context) error {
 		metricsRecorder,
 		logger,
 	)
+	if verifyClientCert {
+		podHandler = requireClientCert(parseList(c.String("client-cert-allowed-names")), podHandler)
+	}
+	endpoint := c.String("tracing-endpoint")
+	if endpoint == "" {
+		return podHandler, func() {}, nil
+	}
+	provider, err := newTracerProvider(context.Background(), endpoint, c.String("tracing-service-name"),
+		c.Float64("tracing-sample-ratio"))
+	if err != nil {
+		return nil, nil, err
+	}
+	logger.WithField("endpoint", endpoint).Info("tracing admission reviews")
+	return traceAdmission(podHandler), func() {
+		if shutdownErr := provider.Shutdown(context.Background()); shutdownErr != nil {
+			logger.WithError(shutdownErr).Warn("error flushing traces")
+		}
+	}, nil
+}
+
+// newServingCertReloader sets up the serving certificate: self-managed, or loaded from the certificate files
+// and reloaded on change. It returns nil when the webhook serves plain HTTP.
+func newServingCertReloader(c *cli.Context, k8sClient kubernetes.Interface) (*certReloader, error) {
+	tlsCertFile := c.String("tls-cert-file")
+	tlsPrivateKeyFile := c.String("tls-private-key-file")
+	switch {
+	case c.Bool("tls-self-managed"):
+		reloader := &certReloader{}
+		selfManaged, err := newSelfManagedTLS(k8sClient, c.String("tls-secret"), c.String("webhook-config-name"),
+			parseList(c.String("tls-dns-names")), c.Duration("tls-cert-validity"), reloader)
+		if err != nil {
+			return nil, err
+		}
+		if err = selfManaged.ensure(context.Background()); err != nil {
+			logger.WithError(err).Fatal("error setting up self-managed TLS certificates")
+		}
+		go selfManaged.run(selfManagedCheckInterval, make(chan struct{}))
+		return reloader, nil
+	case tlsCertFile != "" || tlsPrivateKeyFile != "":
+		reloader, err := newCertReloader(tlsCertFile, tlsPrivateKeyFile)
+		if err != nil {
+			logger.WithError(err).Fatal("error loading TLS certificate")
+		}
+		go reloader.watch(defaultCertReloadInterval, make(chan struct{}))
+		return reloader, nil
+	default:
+		return nil, nil
+	}
+}
+
+// newWebhookServer creates the webhook server, serving HTTPS with the reloaded certificate if it is set up.
+// It returns the server and the function serving the requests.
+func newWebhookServer(addr string, timeouts serverTimeouts, handler http.Handler, reloader *certReloader,
+	tlsOptions serverTLSOptions) (*http.Server, func() error) {
+	server := timeouts.server(addr, handler)
+	if reloader == nil {
+		logger.Infof("listening on http://%s", addr)
+		return server, server.ListenAndServe
+	}
+	server.TLSConfig = serverTLSConfig(reloader, tlsOptions.minVersion, tlsOptions.cipherSuites, tlsOptions.clientCAs)
+	logger.Infof("listening on https://%s", addr)
+	return server, func() error { return server.ListenAndServeTLS("", "") }
+}
+
+// mutation webhook server
+func runWebhook(c *cli.Context) error {
+	if err := validateModes(c); err != nil {
+		return err
+	}
+	tlsOptions, err := parseServerTLSOptions(c)
+	if err != nil {
+		return err
+	}
+
+	k8sClient, err := newK8SClient()
+	if err != nil {
+		logger.WithError(err).Fatal("error creating k8s client")
+	}
+
+	webhook, err := newMutatingWebhook(c, k8sClient)
+	if err != nil {
+		return err
+	}
+	if err = webhook.startInformers(c); err != nil {
+		return err
+	}
+
+	mutator := mutating.MutatorFunc(webhook.podMutator)
+	var config *configWatcher
+	if file := c.String("config-file"); file != "" {
+		if config, err = newConfigWatcher(file, webhook, prometheus.DefaultRegisterer); err != nil {
+			return err
+		}
+		go config.watch(defaultConfigReloadInterval, make(chan struct{}))
+		mutator = config.podMutator
+		logger.WithField("hash", config.active.Load().hash).Info("loaded webhook configuration")
+	}
+
+	podHandler, flushTraces, err := newPodHandler(c, mutator, tlsOptions.clientCAs != nil)
+	if err != nil {
+		return err
+	}
+	defer flushTraces()
 
 	mux := http.NewServeMux()
 	mux.Handle("/pods", podHandler)
 	mux.Handle("/healthz", http.HandlerFunc(healthzHandler))
 
-	telemetryAddress := c.String("telemetry-listen-address")
-	listenAddress := c.String("listen-address")
-	tlsCertFile := c.String("tls-cert-file")
-	tlsPrivateKeyFile := c.String("tls-private-key-file")
-
-	if telemetryAddress != "" {
+	timeouts := serverTimeouts{
+		read:  c.Duration("read-timeout"),
+		write: c.Duration("write-timeout"),
+		idle:  c.Duration("idle-timeout"),
+	}
+	var metricsServer *http.Server
+	if telemetryAddress := c.String("telemetry-listen-address"); telemetryAddress != "" {
 		// Serving metrics without TLS on separated address
-		go serveMetrics(telemetryAddress)
+		metricsServer = serveMetrics(telemetryAddress, timeouts)
 	} else {
 		mux.Handle("/metrics", promhttp.Handler())
 	}
 
-	if tlsCertFile == "" && tlsPrivateKeyFile == "" {
-		logger.Infof("listening on http://%s", listenAddress)
-		err = http.ListenAndServe(listenAddress, mux) // #nosec G114
-	} else {
-		logger.Infof("listening on https://%s", listenAddress)
-		err = http.ListenAndServeTLS(listenAddress, tlsCertFile, tlsPrivateKeyFile, mux) // #nosec G114
+	reloader, err := newServingCertReloader(c, k8sClient)
+	if err != nil {
+		return err
+	}
+
+	mux.Handle("/livez", healthHandler(defaultHealthCheckTimeout, pingCheck()))
+	readinessChecks := webhook.readinessChecks(reloader, c.Duration("cert-expiry-margin"))
+	if config != nil {
+		readinessChecks = append(readinessChecks, config.check())
 	}
+	mux.Handle("/readyz", healthHandler(defaultHealthCheckTimeout, readinessChecks...))
+
+	server, serve := newWebhookServer(c.String("listen-address"), timeouts, mux, reloader, tlsOptions)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	err = serveGracefully(signals, c.Duration("shutdown-drain"), c.Duration("shutdown-timeout"), serve,
+		server, metricsServer)
 
 	if err != nil {
 		logger.WithError(err).Fatal("error serving webhook")
@@ -434,6 +1108,31 @@ func main() {
 					Name:  "telemetry-listen-address",
 					Usage: "specify a dedicated prometheus metrics listen address (using listen-address, if empty)",
 				},
+				cli.DurationFlag{
+					Name:  "read-timeout",
+					Usage: "webhook and metrics servers request read timeout",
+					Value: defaultReadTimeout,
+				},
+				cli.DurationFlag{
+					Name:  "write-timeout",
+					Usage: "webhook and metrics servers response write timeout",
+					Value: defaultWriteTimeout,
+				},
+				cli.DurationFlag{
+					Name:  "idle-timeout",
+					Usage: "webhook and metrics servers keep-alive connections idle timeout",
+					Value: defaultIdleTimeout,
+				},
+				cli.DurationFlag{
+					Name:  "shutdown-drain",
+					Usage: "time to keep serving with /healthz not ready after SIGTERM, before shutting down",
+					Value: defaultShutdownDrain,
+				},
+				cli.DurationFlag{
+					Name:  "shutdown-timeout",
+					Usage: "maximum time to wait for in-flight requests on shutdown",
+					Value: defaultShutdownTimeout,
+				},
 				cli.StringFlag{
 					Name:  "tls-cert-file",
 					Usage: "TLS certificate file",
@@ -442,6 +1141,49 @@ func main() {
 					Name:  "tls-private-key-file",
 					Usage: "TLS private key file",
 				},
+				cli.BoolFlag{
+					Name:  "tls-self-managed",
+					Usage: "generate the webhook CA and TLS certificate, store them in tls-secret and publish the CA in webhook-config-name",
+				},
+				cli.StringFlag{
+					Name:  "tls-secret",
+					Usage: "self-managed TLS Secret, as namespace/name",
+				},
+				cli.StringFlag{
+					Name:  "tls-dns-names",
+					Usage: "comma separated DNS names of the self-managed TLS certificate (e.g. token-injector-webhook.kube-system.svc)",
+				},
+				cli.DurationFlag{
+					Name:  "tls-cert-validity",
+					Usage: "validity of the self-managed TLS certificate, renewed after two thirds of it",
+					Value: defaultSelfManagedValidity,
+				},
+				cli.StringFlag{
+					Name:  "webhook-config-name",
+					Usage: "MutatingWebhookConfiguration the self-managed CA is published in",
+				},
+				cli.StringFlag{
+					Name:  "tls-min-version",
+					Usage: "minimum TLS version: 1.2 or 1.3",
+					Value: "1.2",
+				},
+				cli.StringFlag{
+					Name:  "tls-cipher-suites",
+					Usage: "comma separated TLS 1.2 cipher suites (e.g. TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256), Go defaults if empty",
+				},
+				cli.StringFlag{
+					Name:  "client-ca-file",
+					Usage: "CA certificates file verifying the client certificate required on the admission endpoint (kube-apiserver)",
+				},
+				cli.StringFlag{
+					Name:  "client-cert-allowed-names",
+					Usage: "comma separated client certificate common or DNS names allowed on the admission endpoint, any if empty",
+				},
+				cli.DurationFlag{
+					Name:  "cert-expiry-margin",
+					Usage: "minimum remaining validity of the TLS certificate for the webhook to be ready",
+					Value: defaultCertExpiryMargin,
+				},
 				cli.StringFlag{
 					Name:  "image",
 					Usage: "Docker image with secrets-init utility on board",
@@ -466,6 +1208,165 @@ func main() {
 					Usage: "token file name",
 					Value: tokenFileName,
 				},
+				cli.StringFlag{
+					Name:  "failure-mode",
+					Usage: "what to do with a pod that could not be mutated: allow (admit unmutated with a warning) or deny",
+					Value: failureModeAllow,
+				},
+				cli.StringFlag{
+					Name: "conflict-policy",
+					Usage: "what to do when a container already defines an injected env var or mount: " +
+						"user (user values win), injected (injected values win) or reject (reject the pod)",
+					Value: conflictPolicyInjected,
+				},
+				cli.DurationFlag{
+					Name:  "lookup-timeout",
+					Usage: "timeout for Kubernetes API lookups done while handling a single admission request",
+					Value: defaultLookupTimeout,
+				},
+				cli.BoolTFlag{
+					Name:  "sa-cache",
+					Usage: "serve service accounts and namespaces from an informer cache (falls back to the API server on a cache miss)",
+				},
+				cli.StringFlag{
+					Name:  "sa-cache-namespace-selector",
+					Usage: "label selector limiting the service account cache to matching namespaces (all namespaces, if empty)",
+				},
+				cli.DurationFlag{
+					Name:  "sa-cache-resync",
+					Usage: "service account cache resync period",
+					Value: defaultCacheResync,
+				},
+				cli.StringFlag{
+					Name:  "role-policy-configmap",
+					Usage: "namespace/name of the ConfigMap holding the cluster-wide AWS role ARN policy (no policy, if empty)",
+				},
+				cli.StringFlag{
+					Name:  "role-policy-action",
+					Usage: "what to do with a pod whose role ARN is not allowed by the role ARN policy: deny (reject the pod) or skip (admit it without injection)",
+					Value: rolePolicyActionDeny,
+				},
+				cli.StringFlag{
+					Name:  "aws-default-region",
+					Usage: "AWS region injected for Service Accounts without the " + awsRegionKey + " annotation (none, if empty)",
+				},
+				cli.BoolFlag{
+					Name:  "sts-regional-endpoints",
+					Usage: "use the regional STS endpoint for Service Accounts without the " + awsStsRegionalEndpointsKey + " annotation",
+				},
+				cli.StringFlag{
+					Name: "session-name-template",
+					Usage: "AWS_ROLE_SESSION_NAME Go template, with the .Namespace, .Pod, .ServiceAccount, .Container, " +
+						".Random and .Hash variables",
+					Value: defaultSessionNameTemplate,
+				},
+				cli.StringFlag{
+					Name:  "injector-requests-cpu",
+					Usage: "token-injector containers CPU request (none, if empty)",
+					Value: requestsCPU,
+				},
+				cli.StringFlag{
+					Name:  "injector-requests-memory",
+					Usage: "token-injector containers memory request (none, if empty)",
+					Value: requestsMemory,
+				},
+				cli.StringFlag{
+					Name:  "injector-limits-cpu",
+					Usage: "token-injector containers CPU limit (none, if empty)",
+					Value: limitsCPU,
+				},
+				cli.StringFlag{
+					Name:  "injector-limits-memory",
+					Usage: "token-injector containers memory limit (none, if empty)",
+					Value: limitsMemory,
+				},
+				cli.BoolTFlag{
+					Name:  "injector-run-as-non-root",
+					Usage: "run the token-injector containers as non-root",
+				},
+				cli.Int64Flag{
+					Name:  "injector-run-as-user",
+					Usage: "token-injector containers user ID (image user, if 0)",
+					Value: defaultInjectorRunAsUser,
+				},
+				cli.BoolTFlag{
+					Name:  "injector-read-only-root-filesystem",
+					Usage: "mount the token-injector containers root filesystem read-only",
+				},
+				cli.StringFlag{
+					Name:  "injector-drop-capabilities",
+					Usage: "comma separated capabilities dropped from the token-injector containers",
+					Value: defaultInjectorDropCapabilities,
+				},
+				cli.StringFlag{
+					Name:  "injector-seccomp-profile",
+					Usage: "token-injector containers seccomp profile: RuntimeDefault, Unconfined, Localhost/<profile> (none, if empty)",
+					Value: defaultInjectorSeccompProfile,
+				},
+				cli.StringFlag{
+					Name: "sidecar-mode",
+					Usage: "how the token refresh container is injected: container (regular sidecar container), " +
+						"native (native sidecar, Kubernetes 1.29+), job (native sidecar for Job pods only) " +
+						"or auto (native sidecar if the cluster supports it)",
+					Value: sidecarModeContainer,
+				},
+				cli.StringFlag{
+					Name: "job-lifecycle",
+					Usage: "how the regular sidecar token refresh container exits with the workload of Job pods: " +
+						"file (termination file only), process (shared process namespace and termination file; the containers " +
+						"processes become visible to each other and the workload is no longer PID 1) or none; with file, Job pods " +
+						"only complete if the workload writes the termination file. Overridden per pod by the " + jobLifecycleKey + " annotation",
+					Value: jobLifecycleFile,
+				},
+				cli.StringFlag{
+					Name:  "init-container-placement",
+					Usage: "placement of the injected init container: first, last or after:<container>",
+					Value: placementFirst,
+				},
+				cli.StringFlag{
+					Name:  "tracing-endpoint",
+					Usage: "OTLP/HTTP endpoint URL the admission review traces are exported to (e.g. http://otel-collector:4318), tracing is disabled if empty",
+				},
+				cli.Float64Flag{
+					Name:  "tracing-sample-ratio",
+					Usage: "ratio of the admission reviews traced, when the kube-apiserver did not sample the trace",
+					Value: 1,
+				},
+				cli.StringFlag{
+					Name:  "tracing-service-name",
+					Usage: "service name reported in the traces",
+					Value: defaultTracingServiceName,
+				},
+				cli.StringFlag{
+					Name: "metrics-account-id-labels",
+					Usage: "role ARN account IDs labeled in the token_injector_role_arn_injections_total metric: " +
+						"all, none or a comma separated list of account IDs, the other accounts are labeled \"other\"",
+					Value: accountIDLabelsAll,
+				},
+				cli.BoolTFlag{
+					Name:  "events",
+					Usage: "record Kubernetes Events on the pod owners and Service Accounts about skipped or failed injections",
+				},
+				cli.Float64Flag{
+					Name:  "events-qps",
+					Usage: "rate of the Events on a single object, once the burst is exhausted",
+					Value: defaultEventsQPS,
+				},
+				cli.IntFlag{
+					Name:  "events-burst",
+					Usage: "burst of the Events on a single object",
+					Value: defaultEventsBurst,
+				},
+				cli.StringFlag{
+					Name: "config-file",
+					Usage: "YAML or JSON webhook configuration file (e.g. a mounted ConfigMap), reloaded when it changes; " +
+						"the settings it defines override the matching flags",
+				},
+				cli.StringFlag{
+					Name: "mesh-exclude-annotations",
+					Usage: "comma separated pod annotations listing the outbound IP ranges excluded from service mesh interception, " +
+						"the metadata server address is added to (e.g. traffic.sidecar.istio.io/excludeOutboundIPRanges)",
+				},
 			},
 			Usage:       "mutation admission webhook",
 			Description: "run mutation admission webhook server",
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -9,11 +11,14 @@ import (
 	"testing"
 
 	cmp "github.com/google/go-cmp/cmp"
+	whmodel "github.com/slok/kubewebhook/v2/pkg/model"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 	fake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 func TestMain(m *testing.M) {
@@ -21,6 +26,16 @@ func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
 
+// enabledLabels returns the pod labels opting the pod in to the injection.
+func enabledLabels() map[string]string {
+	return map[string]string{enabledLabelKey: "true"}
+}
+
+// testNamespace returns a namespace without annotations.
+func testNamespace(name string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+}
+
 //nolint:funlen
 func Test_mutatingWebhook_mutateContainers(t *testing.T) {
 	type fields struct {
@@ -145,7 +160,11 @@ func Test_mutatingWebhook_mutateContainers(t *testing.T) {
 				volumePath: tt.fields.volumePath,
 				tokenFile:  tt.fields.tokenFile,
 			}
-			got := mw.mutateContainers(tt.args.containers, tt.args.roleArn)
+			got, err := mw.mutateContainers(tt.args.containers, tt.args.roleArn, nil, sessionNameData{Random: randomString(16)}, containerSelector{},
+				newMerger(&corev1.Pod{}, conflictPolicyInjected, false))
+			if err != nil {
+				t.Fatalf("mutatingWebhook.mutateContainers() unexpected error = %v", err)
+			}
 			if got != tt.mutated {
 				t.Errorf("mutatingWebhook.mutateContainers() = %v, want %v", got, tt.mutated)
 			}
@@ -189,6 +208,7 @@ func Test_mutatingWebhook_mutatePod(t *testing.T) {
 			},
 			args: args{
 				pod: &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{Labels: enabledLabels()},
 					Spec: corev1.PodSpec{
 						Containers: []corev1.Container{
 							{
@@ -204,6 +224,16 @@ func Test_mutatingWebhook_mutatePod(t *testing.T) {
 				annotations:        map[string]string{awsRoleArnKey: "arn:aws:iam::123456789012:role/testrole"},
 			},
 			wantedPod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: enabledLabels(),
+					Annotations: map[string]string{
+						injectionStatusKey:   injectionStatusInjected,
+						webhookVersionKey:    Version,
+						injectorImageKey:     "ealebed/token-injector/token-injector:test",
+						roleArnSourceKey:     roleSourceServiceAccount,
+						mutatedContainersKey: "TestContainer",
+					},
+				},
 				Spec: corev1.PodSpec{
 					InitContainers: []corev1.Container{
 						{
@@ -220,6 +250,7 @@ func Test_mutatingWebhook_mutatePod(t *testing.T) {
 									corev1.ResourceMemory: resource.MustParse(limitsMemory),
 								},
 							},
+							SecurityContext: defaultInjectorSpec().securityContext(),
 							VolumeMounts: []corev1.VolumeMount{
 								{
 									Name:      "test-volume-name",
@@ -254,6 +285,7 @@ func Test_mutatingWebhook_mutatePod(t *testing.T) {
 									corev1.ResourceMemory: resource.MustParse(limitsMemory),
 								},
 							},
+							SecurityContext: defaultInjectorSpec().securityContext(),
 							VolumeMounts: []corev1.VolumeMount{
 								{
 									Name:      "test-volume-name",
@@ -288,14 +320,23 @@ func Test_mutatingWebhook_mutatePod(t *testing.T) {
 				},
 			}
 			mw := &mutatingWebhook{
-				k8sClient:  fake.NewSimpleClientset(sa),
+				k8sClient:  fake.NewSimpleClientset(sa, testNamespace("test-namespace")),
 				image:      tt.fields.image,
 				pullPolicy: tt.fields.pullPolicy,
 				volumeName: tt.fields.volumeName,
 				volumePath: tt.fields.volumePath,
 				tokenFile:  tt.fields.tokenFile,
 			}
-			mw.mutatePod(context.TODO(), tt.args.pod, tt.args.ns, tt.args.dryRun)
+			if _, err := mw.mutatePod(context.TODO(), tt.args.pod, tt.args.ns, tt.args.dryRun); err != nil {
+				t.Fatalf("mutatingWebhook.mutatePod() unexpected error = %v", err)
+			}
+			// the config hash is covered by Test_appliedConfig_hash
+			if hash, ok := tt.args.pod.Annotations[configHashKey]; ok {
+				if len(hash) != sha256.Size*2 {
+					t.Errorf("mutatingWebhook.mutatePod() config hash = %q, want a SHA-256", hash)
+				}
+				delete(tt.args.pod.Annotations, configHashKey)
+			}
 			if !cmp.Equal(tt.args.pod, tt.wantedPod) {
 				t.Errorf("mutatingWebhook.mutateContainers() = diff %v", cmp.Diff(tt.args.pod, tt.wantedPod))
 			}
@@ -303,6 +344,111 @@ func Test_mutatingWebhook_mutatePod(t *testing.T) {
 	}
 }
 
+func Test_mutatingWebhook_mutatePod_idempotent(t *testing.T) {
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test-sa",
+			Namespace:   "test-namespace",
+			Annotations: map[string]string{awsRoleArnKey: "arn:aws:iam::123456789012:role/testrole"},
+		},
+	}
+	mw := &mutatingWebhook{
+		k8sClient:  fake.NewSimpleClientset(sa, testNamespace("test-namespace")),
+		image:      "ealebed/token-injector/token-injector:test",
+		volumeName: tokenVolumeName,
+		volumePath: tokenVolumePath,
+		tokenFile:  tokenFileName,
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Labels: enabledLabels()},
+		Spec: corev1.PodSpec{
+			ServiceAccountName: "test-sa",
+			InitContainers:     []corev1.Container{{Name: "TestInitContainer", Image: "test-image"}},
+			Containers:         []corev1.Container{{Name: "TestContainer", Image: "test-image"}},
+		},
+	}
+	if _, err := mw.mutatePod(context.TODO(), pod, "test-namespace", false); err != nil {
+		t.Fatalf("mutatingWebhook.mutatePod() unexpected error = %v", err)
+	}
+	once := pod.DeepCopy()
+	if _, err := mw.mutatePod(context.TODO(), pod, "test-namespace", false); err != nil {
+		t.Fatalf("mutatingWebhook.mutatePod() unexpected error = %v", err)
+	}
+	if got := pod.Annotations[injectionStatusKey]; got != injectionStatusReconciled {
+		t.Errorf("mutatingWebhook.mutatePod() injection status = %v, want %v", got, injectionStatusReconciled)
+	}
+	once.Annotations[injectionStatusKey] = injectionStatusReconciled
+	if !cmp.Equal(pod, once) {
+		t.Errorf("mutatingWebhook.mutatePod() is not idempotent, diff %v", cmp.Diff(pod, once))
+	}
+}
+
+func Test_mutatingWebhook_podMutator_lookupError(t *testing.T) {
+	tests := []struct {
+		name        string
+		failureMode string
+		wantDenied  bool
+	}{
+		{
+			name:        "allow unmutated pod with warning",
+			failureMode: failureModeAllow,
+		},
+		{
+			name:        "deny pod",
+			failureMode: failureModeDeny,
+			wantDenied:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			client.PrependReactor("get", "serviceaccounts", func(k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, errors.New("api server unavailable")
+			})
+			mw := &mutatingWebhook{
+				k8sClient:   client,
+				volumeName:  tokenVolumeName,
+				volumePath:  tokenVolumePath,
+				tokenFile:   tokenFileName,
+				failureMode: tt.failureMode,
+			}
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Labels: enabledLabels()},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: "test-sa",
+					Containers:         []corev1.Container{{Name: "TestContainer", Image: "test-image"}},
+				},
+			}
+			original := pod.DeepCopy()
+			res, err := mw.podMutator(context.TODO(), &whmodel.AdmissionReview{Namespace: "test-namespace"}, pod)
+			var denied *admissionDeniedError
+			if tt.wantDenied {
+				if !errors.As(err, &denied) {
+					t.Fatalf("mutatingWebhook.podMutator() error = %v, want admission denial", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("mutatingWebhook.podMutator() unexpected error = %v", err)
+			}
+			if len(res.Warnings) != 1 {
+				t.Errorf("mutatingWebhook.podMutator() warnings = %v, want one warning", res.Warnings)
+			}
+			if !cmp.Equal(res.MutatedObject, original) {
+				t.Errorf("mutatingWebhook.podMutator() = diff %v", cmp.Diff(res.MutatedObject, original))
+			}
+		})
+	}
+}
+
+func Test_validateFailureMode(t *testing.T) {
+	for mode, wantErr := range map[string]bool{failureModeAllow: false, failureModeDeny: false, "": true, "ignore": true} {
+		if err := validateFailureMode(mode); (err != nil) != wantErr {
+			t.Errorf("validateFailureMode(%q) error = %v, wantErr %v", mode, err, wantErr)
+		}
+	}
+}
+
 func Test_randomString(t *testing.T) {
 	// Set test mode to ensure deterministic output
 	originalTestMode := testMode
@@ -571,7 +717,7 @@ func Test_getInjectorContainer(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := getInjectorContainer(tt.containerName, tt.image, tt.pullPolicy, tt.volumeName, tt.volumePath, tt.tokenFile, tt.refresh)
+			got := getInjectorContainer(tt.containerName, tt.image, tt.pullPolicy, tt.volumeName, tt.volumePath, tt.tokenFile, tt.refresh, defaultInjectorSpec())
 
 			// Check Name
 			if got.Name != tt.want.Name {
@@ -638,6 +784,7 @@ func Test_healthzHandler(t *testing.T) {
 	tests := []struct {
 		name           string
 		method         string
+		draining       bool
 		expectedStatus int
 	}{
 		{
@@ -645,6 +792,12 @@ func Test_healthzHandler(t *testing.T) {
 			method:         "GET",
 			expectedStatus: 200,
 		},
+		{
+			name:           "draining",
+			method:         "GET",
+			draining:       true,
+			expectedStatus: 503,
+		},
 		{
 			name:           "POST request",
 			method:         "POST",
@@ -664,6 +817,8 @@ func Test_healthzHandler(t *testing.T) {
 				t.Fatalf("failed to create request: %v", err)
 			}
 
+			draining.Store(tt.draining)
+			t.Cleanup(func() { draining.Store(false) })
 			rr := httptest.NewRecorder()
 			handler := http.HandlerFunc(healthzHandler)
 
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// mutation outcomes
+const (
+	outcomeInjected            = "injected"
+	outcomeSkippedNoAnnotation = "skipped-no-annotation"
+	outcomeSkippedOptOut       = "skipped-opt-out"
+	outcomeSkippedLabel        = "skipped-label-disabled"
+	outcomeSkippedNoContainers = "skipped-no-containers"
+	outcomeDenied              = "denied"
+	outcomeError               = "error"
+)
+
+// role ARN account ID label modes; any other value is a comma separated list of account IDs
+const (
+	accountIDLabelsAll  = "all"
+	accountIDLabelsNone = "none"
+
+	// account ID label value of the accounts not labeled
+	otherAccountID = "other"
+)
+
+// injectionMetrics holds the Prometheus metrics describing the injection; nil records nothing.
+type injectionMetrics struct {
+	mutations         *prometheus.CounterVec
+	saLookupDuration  prometheus.Histogram
+	saLookupErrors    prometheus.Counter
+	mutatedContainers prometheus.Histogram
+	roleAccounts      *prometheus.CounterVec
+
+	// labeled account IDs, all if nil
+	accountIDs []string
+}
+
+// newInjectionMetrics creates the injection metrics and registers them with the given registerer. The role
+// ARN account IDs are labeled according to accountIDLabels: all, none, or a comma separated list of account
+// IDs; the other accounts are labeled "other".
+func newInjectionMetrics(reg prometheus.Registerer, accountIDLabels string) (*injectionMetrics, error) {
+	m := &injectionMetrics{
+		mutations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "token_injector",
+			Name:      "mutations_total",
+			Help:      "Pod mutations by namespace and outcome (injected, skipped-no-annotation, skipped-opt-out, denied, error).",
+		}, []string{"namespace", "outcome"}),
+		saLookupDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "token_injector",
+			Subsystem: "serviceaccount",
+			Name:      "lookup_duration_seconds",
+			Help:      "Duration of the pod ServiceAccount lookups.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+		}),
+		saLookupErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "token_injector",
+			Subsystem: "serviceaccount",
+			Name:      "lookup_errors_total",
+			Help:      "Failed pod ServiceAccount lookups.",
+		}),
+		mutatedContainers: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "token_injector",
+			Name:      "mutated_containers",
+			Help:      "Number of init containers and containers mutated per injected pod.",
+			Buckets:   prometheus.LinearBuckets(1, 1, 10),
+		}),
+		roleAccounts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "token_injector",
+			Name:      "role_arn_injections_total",
+			Help:      "Injected pods by AWS Role ARN account ID.",
+		}, []string{"account_id"}),
+	}
+	switch accountIDLabels {
+	case accountIDLabelsAll:
+	case accountIDLabelsNone:
+		m.accountIDs = []string{}
+	default:
+		m.accountIDs = parseList(accountIDLabels)
+		if len(m.accountIDs) == 0 || slices.ContainsFunc(m.accountIDs, func(id string) bool { return !accountIDPattern.MatchString(id) }) {
+			return nil, fmt.Errorf("invalid account ID labels %q: must be %q, %q or a list of account IDs",
+				accountIDLabels, accountIDLabelsAll, accountIDLabelsNone)
+		}
+	}
+	for _, c := range []prometheus.Collector{m.mutations, m.saLookupDuration, m.saLookupErrors, m.mutatedContainers, m.roleAccounts} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// mutationOutcome returns the outcome of the pod mutation, from its error or injection status annotations.
+func mutationOutcome(pod *corev1.Pod, err error) string {
+	var denied *admissionDeniedError
+	switch {
+	case errors.As(err, &denied):
+		return outcomeDenied
+	case err != nil:
+		return outcomeError
+	case pod.Annotations[injectionStatusKey] != injectionStatusSkipped:
+		return outcomeInjected
+	}
+	switch pod.Annotations[skipReasonKey] {
+	case skipReasonNoRoleArn:
+		return outcomeSkippedNoAnnotation
+	case skipReasonLabelDisabled:
+		return outcomeSkippedLabel
+	case skipReasonNoContainersSelected:
+		return outcomeSkippedNoContainers
+	case skipReasonRoleNotAllowed:
+		return outcomeDenied
+	default:
+		return outcomeSkippedOptOut
+	}
+}
+
+// observeMutation counts the pod mutation outcome.
+func (m *injectionMetrics) observeMutation(ns string, pod *corev1.Pod, err error) {
+	if m == nil {
+		return
+	}
+	m.mutations.WithLabelValues(ns, mutationOutcome(pod, err)).Inc()
+}
+
+// observeServiceAccountLookup records the ServiceAccount lookup duration and error.
+func (m *injectionMetrics) observeServiceAccountLookup(start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	m.saLookupDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.saLookupErrors.Inc()
+	}
+}
+
+// observeInjection records the number of mutated containers and the role ARN account ID of an injected pod.
+func (m *injectionMetrics) observeInjection(roleArn *roleARN, containers int) {
+	if m == nil {
+		return
+	}
+	m.mutatedContainers.Observe(float64(containers))
+	m.roleAccounts.WithLabelValues(m.accountIDLabel(roleArn.AccountID)).Inc()
+}
+
+// accountIDLabel returns the account ID label value: the account ID if labeled, "other" otherwise.
+func (m *injectionMetrics) accountIDLabel(accountID string) string {
+	if m.accountIDs == nil || slices.Contains(m.accountIDs, accountID) {
+		return accountID
+	}
+	return otherAccountID
+}
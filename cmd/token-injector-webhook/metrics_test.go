@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	whmodel "github.com/slok/kubewebhook/v2/pkg/model"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+// histogramSampleCount returns the number of observations of the histogram registered with the registry.
+func histogramSampleCount(t *testing.T, reg *prometheus.Registry, name string) uint64 {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range families {
+		if mf.GetName() == name {
+			return mf.GetMetric()[0].GetHistogram().GetSampleCount()
+		}
+	}
+	return 0
+}
+
+func Test_newInjectionMetrics_accountIDLabels(t *testing.T) {
+	tests := []struct {
+		labels  string
+		want    map[string]string
+		wantErr bool
+	}{
+		{labels: accountIDLabelsAll, want: map[string]string{"123456789012": "123456789012", "210987654321": "210987654321"}},
+		{labels: accountIDLabelsNone, want: map[string]string{"123456789012": otherAccountID}},
+		{labels: "123456789012, 111111111111", want: map[string]string{"123456789012": "123456789012", "210987654321": otherAccountID}},
+		{labels: "", wantErr: true},
+		{labels: "123", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.labels, func(t *testing.T) {
+			m, err := newInjectionMetrics(prometheus.NewRegistry(), tt.labels)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newInjectionMetrics() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for accountID, want := range tt.want {
+				if got := m.accountIDLabel(accountID); got != want {
+					t.Errorf("injectionMetrics.accountIDLabel(%s) = %q, want %q", accountID, got, want)
+				}
+			}
+		})
+	}
+}
+
+//nolint:funlen
+func Test_mutatingWebhook_podMutator_metrics(t *testing.T) {
+	tests := []struct {
+		name           string
+		saName         string
+		saRoleArn      string
+		podLabels      map[string]string
+		podAnnotations map[string]string
+		wantOutcome    string
+		wantInjected   bool
+		wantLookupErr  bool
+	}{
+		{name: "injected", saName: "test-sa", saRoleArn: testRoleArn, wantOutcome: outcomeInjected, wantInjected: true},
+		{name: "no role ARN", saName: "test-sa", wantOutcome: outcomeSkippedNoAnnotation},
+		{
+			name: "opt out", saName: "test-sa", saRoleArn: testRoleArn,
+			podAnnotations: map[string]string{injectKey: "false"}, wantOutcome: outcomeSkippedOptOut,
+		},
+		{
+			name: "label disabled", saName: "test-sa", saRoleArn: testRoleArn,
+			podLabels: map[string]string{enabledLabelKey: "false"}, wantOutcome: outcomeSkippedLabel,
+		},
+		{
+			name: "no containers selected", saName: "test-sa", saRoleArn: testRoleArn,
+			podAnnotations: map[string]string{containersKey: "sidecar"}, wantOutcome: outcomeSkippedNoContainers,
+		},
+		{
+			name: "pod role ARN not allowed", saName: "test-sa",
+			podAnnotations: map[string]string{awsRoleArnKey: testRoleArn}, wantOutcome: outcomeDenied,
+		},
+		{name: "missing service account", saName: "missing-sa", wantOutcome: outcomeError, wantLookupErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+				Name: "test-sa", Namespace: "test-namespace", Annotations: map[string]string{},
+			}}
+			if tt.saRoleArn != "" {
+				sa.Annotations[awsRoleArnKey] = tt.saRoleArn
+			}
+			reg := prometheus.NewRegistry()
+			m, err := newInjectionMetrics(reg, accountIDLabelsAll)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mw := &mutatingWebhook{
+				k8sClient:   fake.NewSimpleClientset(sa, testNamespace("test-namespace")),
+				volumeName:  tokenVolumeName,
+				volumePath:  tokenVolumePath,
+				tokenFile:   tokenFileName,
+				failureMode: failureModeAllow,
+				metrics:     m,
+			}
+			labels := enabledLabels()
+			if tt.podLabels != nil {
+				labels = tt.podLabels
+			}
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels, Annotations: tt.podAnnotations},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: tt.saName,
+					InitContainers:     []corev1.Container{{Name: "migrate"}},
+					Containers:         []corev1.Container{{Name: "app"}},
+				},
+			}
+			_, _ = mw.podMutator(context.TODO(), &whmodel.AdmissionReview{Namespace: "test-namespace"}, pod)
+
+			if got := testutil.ToFloat64(m.mutations.WithLabelValues("test-namespace", tt.wantOutcome)); got != 1 {
+				t.Errorf("%s mutations = %v, want 1", tt.wantOutcome, got)
+			}
+			if got := testutil.CollectAndCount(m.mutations); got != 1 {
+				t.Errorf("mutations series = %d, want 1", got)
+			}
+			// the opt-in label and pod opt-out are decided before the ServiceAccount lookup
+			wantLookups := uint64(1)
+			if tt.wantOutcome == outcomeSkippedOptOut || tt.wantOutcome == outcomeSkippedLabel {
+				wantLookups = 0
+			}
+			if got := histogramSampleCount(t, reg, "token_injector_serviceaccount_lookup_duration_seconds"); got != wantLookups {
+				t.Errorf("ServiceAccount lookups = %d, want %d", got, wantLookups)
+			}
+			wantErrors := 0.0
+			if tt.wantLookupErr {
+				wantErrors = 1
+			}
+			if got := testutil.ToFloat64(m.saLookupErrors); got != wantErrors {
+				t.Errorf("ServiceAccount lookup errors = %v, want %v", got, wantErrors)
+			}
+			wantInjected := 0.0
+			if tt.wantInjected {
+				wantInjected = 1
+				if got := histogramSampleCount(t, reg, "token_injector_mutated_containers"); got != 1 {
+					t.Errorf("mutated containers observations = %d, want 1", got)
+				}
+			}
+			if got := testutil.ToFloat64(m.roleAccounts.WithLabelValues("123456789012")); got != wantInjected {
+				t.Errorf("role ARN account injections = %v, want %v", got, wantInjected)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+)
+
+// TLS versions accepted by the --tls-min-version flag
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parseTLSVersion parses a minimum TLS version: 1.2 or 1.3.
+func parseTLSVersion(version string) (uint16, error) {
+	v, ok := tlsVersions[version]
+	if !ok {
+		return 0, fmt.Errorf("invalid TLS version %q: must be 1.2 or 1.3", version)
+	}
+	return v, nil
+}
+
+// parseCipherSuites parses cipher suite names (e.g. TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256); an empty list
+// selects the Go default suites. Insecure suites are rejected.
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	suites := make([]uint16, 0, len(names))
+	for _, name := range names {
+		i := slices.IndexFunc(tls.CipherSuites(), func(s *tls.CipherSuite) bool { return s.Name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("invalid or insecure TLS cipher suite %q", name)
+		}
+		suites = append(suites, tls.CipherSuites()[i].ID)
+	}
+	return suites, nil
+}
+
+// loadClientCAs loads the PEM encoded CA certificates used to verify client certificates.
+func loadClientCAs(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file) // #nosec G304
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no CA certificate found in %s", file)
+	}
+	return pool, nil
+}
+
+// serverTLSConfig returns the webhook server TLS configuration. With client CAs, client certificates are
+// verified when presented, and required by requireClientCert on the admission endpoint only, so that the
+// kubelet probes do not need one.
+func serverTLSConfig(reloader *certReloader, minVersion uint16, cipherSuites []uint16, clientCAs *x509.CertPool) *tls.Config {
+	config := &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+	}
+	if clientCAs != nil {
+		config.ClientCAs = clientCAs
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config
+}
+
+// errClientCertRequired is returned to clients calling the admission endpoint without a verified certificate.
+var errClientCertRequired = errors.New("a client certificate signed by the client CA is required")
+
+// clientCertAllowed reports whether the verified client certificate is allowed: any certificate if no names
+// are set, or a certificate whose common name or a DNS name is one of the names.
+func clientCertAllowed(cert *x509.Certificate, names []string) bool {
+	if len(names) == 0 || slices.Contains(names, cert.Subject.CommonName) {
+		return true
+	}
+	return slices.ContainsFunc(cert.DNSNames, func(name string) bool { return slices.Contains(names, name) })
+}
+
+// requireClientCert only lets requests with a client certificate verified against the client CAs, and
+// allowed names if any, through to the next handler.
+func requireClientCert(names []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			logger.WithField("remote", r.RemoteAddr).Warn("rejected admission request without client certificate")
+			http.Error(w, errClientCertRequired.Error(), http.StatusUnauthorized)
+			return
+		}
+		if cert := r.TLS.VerifiedChains[0][0]; !clientCertAllowed(cert, names) {
+			logger.WithField("remote", r.RemoteAddr).WithField("subject", cert.Subject.String()).
+				Warn("rejected admission request with a client certificate not allowed")
+			http.Error(w, "client certificate not allowed", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
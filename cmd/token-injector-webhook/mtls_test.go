@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k8s.io/utils/ptr"
+)
+
+func Test_parseTLSVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    uint16
+		wantErr bool
+	}{
+		{version: "1.2", want: tls.VersionTLS12},
+		{version: "1.3", want: tls.VersionTLS13},
+		{version: "1.1", wantErr: true},
+		{version: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			got, err := parseTLSVersion(tt.version)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTLSVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseTLSVersion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseCipherSuites(t *testing.T) {
+	got, err := parseCipherSuites([]string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"})
+	if err != nil {
+		t.Fatalf("parseCipherSuites() unexpected error = %v", err)
+	}
+	if len(got) != 2 || got[0] != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 || got[1] != tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384 {
+		t.Errorf("parseCipherSuites() = %v", got)
+	}
+	if got, err = parseCipherSuites(nil); err != nil || got != nil {
+		t.Errorf("parseCipherSuites(nil) = %v, %v, want nil, nil", got, err)
+	}
+	for _, name := range []string{"TLS_RSA_WITH_RC4_128_SHA", "TLS_UNKNOWN"} {
+		if _, err = parseCipherSuites([]string{name}); err == nil {
+			t.Errorf("parseCipherSuites(%s) expected error", name)
+		}
+	}
+}
+
+func Test_clientCertAllowed(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "kube-apiserver"}, DNSNames: []string{"apiserver.example.com"}}
+	tests := []struct {
+		name  string
+		names []string
+		want  bool
+	}{
+		{name: "any name", want: true},
+		{name: "common name", names: []string{"kube-apiserver"}, want: true},
+		{name: "DNS name", names: []string{"apiserver.example.com"}, want: true},
+		{name: "other name", names: []string{"kubelet"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clientCertAllowed(cert, tt.names); got != tt.want {
+				t.Errorf("clientCertAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// testClientCert generates a client certificate with the common name, signed by the CA.
+func testClientCert(t *testing.T, ca *keyPair, commonName string) tls.Certificate {
+	t.Helper()
+	pair, err := generateKeyPair(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: commonName},
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    time.Now().Add(time.Hour),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(pair.certPEM, pair.keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func testCA(t *testing.T) *keyPair {
+	t.Helper()
+	ca, err := generateKeyPair(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca
+}
+
+//nolint:funlen
+func Test_requireClientCert(t *testing.T) {
+	ca, otherCA := testCA(t), testCA(t)
+	serving, err := generateKeyPair(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "token-injector-webhook"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    time.Now().Add(time.Hour),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	servingCert, err := tls.X509KeyPair(serving.certPEM, serving.keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloader := &certReloader{}
+	reloader.set(&servingCert)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	mux := http.NewServeMux()
+	mux.Handle("/pods", requireClientCert([]string{"kube-apiserver"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+	mux.Handle("/livez", healthHandler(time.Second, pingCheck()))
+	server := httptest.NewUnstartedServer(mux)
+	server.TLS = serverTLSConfig(reloader, tls.VersionTLS12, nil, clientCAs)
+	// httptest sets its own certificate unless one is set, which takes precedence over GetCertificate
+	server.TLS.Certificates = []tls.Certificate{servingCert}
+	server.StartTLS()
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		clientCert *tls.Certificate
+		wantStatus int
+		wantErr    bool
+	}{
+		{name: "probe without client certificate", path: "/livez", wantStatus: http.StatusOK},
+		{name: "admission without client certificate", path: "/pods", wantStatus: http.StatusUnauthorized},
+		{name: "admission with allowed certificate", path: "/pods", clientCert: ptr.To(testClientCert(t, ca, "kube-apiserver")), wantStatus: http.StatusOK},
+		{name: "admission with other name", path: "/pods", clientCert: ptr.To(testClientCert(t, ca, "kubelet")), wantStatus: http.StatusForbidden},
+		{name: "admission with certificate of other CA", path: "/pods", clientCert: ptr.To(testClientCert(t, otherCA, "kube-apiserver")), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roots := x509.NewCertPool()
+			roots.AddCert(ca.cert)
+			clientTLS := &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+			if tt.clientCert != nil {
+				clientTLS.Certificates = []tls.Certificate{*tt.clientCert}
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+			resp, err := client.Get(server.URL + tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GET %s error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("GET %s status = %d, want %d", tt.path, resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
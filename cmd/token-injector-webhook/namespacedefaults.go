@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// namespace annotations overriding the global injection defaults for the pods in the namespace; the injector
+	// containers resources and security context are overridden with the pod annotation keys (injectorRequestsCPUKey...)
+	namespaceImageKey               = "token-injector.io/default-injector-image"
+	namespacePullPolicyKey          = "token-injector.io/default-injector-pull-policy"
+	namespaceRegionKey              = "token-injector.io/default-region"
+	namespaceSessionNameTemplateKey = "token-injector.io/default-session-name-template"
+
+	// scopes of the injection settings annotations
+	annotationScopePod       = "pod"
+	annotationScopeNamespace = "namespace"
+)
+
+// withNamespaceDefaults returns a copy of the webhook with its global settings overridden by the namespace
+// annotations; invalid annotations are ignored and reported as warnings. The pod and Service Account annotations,
+// applied afterwards, take precedence over the namespace ones.
+func (mw *mutatingWebhook) withNamespaceDefaults(ns *corev1.Namespace) (*mutatingWebhook, []string) {
+	scoped := *mw
+	var warnings []string
+	invalid := func(key, value string) {
+		warnings = append(warnings, fmt.Sprintf("token-injector: ignoring invalid %s %s annotation %q",
+			annotationScopeNamespace, key, value))
+	}
+	annotations := ns.GetAnnotations()
+	if image := annotations[namespaceImageKey]; image != "" {
+		scoped.image = image
+	}
+	if policy, ok := annotations[namespacePullPolicyKey]; ok {
+		if err := validatePullPolicy(policy); err != nil {
+			invalid(namespacePullPolicyKey, policy)
+		} else {
+			scoped.pullPolicy = policy
+		}
+	}
+	if region := annotations[namespaceRegionKey]; region != "" {
+		scoped.defaultRegion = region
+	}
+	if text, ok := annotations[namespaceSessionNameTemplateKey]; ok {
+		if namer, err := newSessionNamer(text); err != nil {
+			invalid(namespaceSessionNameTemplateKey, text)
+		} else {
+			scoped.sessionNamer = namer
+		}
+	}
+	spec := defaultInjectorSpec()
+	if mw.injector != nil {
+		spec = *mw.injector
+	}
+	spec, specWarnings := spec.withOverrides(annotations, annotationScopeNamespace)
+	scoped.injector = &spec
+	return &scoped, append(warnings, specWarnings...)
+}
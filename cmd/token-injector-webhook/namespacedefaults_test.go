@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+//nolint:funlen
+func Test_mutatingWebhook_mutatePod_namespaceDefaults(t *testing.T) {
+	tests := []struct {
+		name            string
+		nsAnnotations   map[string]string
+		saAnnotations   map[string]string
+		podAnnotations  map[string]string
+		wantImage       string
+		wantPullPolicy  corev1.PullPolicy
+		wantLimitsCPU   string
+		wantRegion      string
+		wantSessionName string
+		wantWarnings    int
+	}{
+		{
+			name:            "global defaults",
+			wantImage:       "example.com/token-injector:v1",
+			wantPullPolicy:  corev1.PullIfNotPresent,
+			wantLimitsCPU:   limitsCPU,
+			wantRegion:      "us-east-1",
+			wantSessionName: "token-injector-webhook-0000000000000000",
+		},
+		{
+			name: "namespace defaults",
+			nsAnnotations: map[string]string{
+				namespaceImageKey:               "example.com/team/token-injector:v2",
+				namespacePullPolicyKey:          "Always",
+				injectorLimitsCPUKey:            "100m",
+				namespaceRegionKey:              "eu-west-1",
+				namespaceSessionNameTemplateKey: "{{.Namespace}}-{{.Container}}",
+			},
+			wantImage:       "example.com/team/token-injector:v2",
+			wantPullPolicy:  corev1.PullAlways,
+			wantLimitsCPU:   "100m",
+			wantRegion:      "eu-west-1",
+			wantSessionName: "test-namespace-app",
+		},
+		{
+			name:            "pod and service account annotations win",
+			nsAnnotations:   map[string]string{injectorLimitsCPUKey: "100m", namespaceRegionKey: "eu-west-1"},
+			saAnnotations:   map[string]string{awsRegionKey: "eu-central-1"},
+			podAnnotations:  map[string]string{injectorLimitsCPUKey: "200m"},
+			wantImage:       "example.com/token-injector:v1",
+			wantPullPolicy:  corev1.PullIfNotPresent,
+			wantLimitsCPU:   "200m",
+			wantRegion:      "eu-central-1",
+			wantSessionName: "token-injector-webhook-0000000000000000",
+		},
+		{
+			name:            "pod limit below the namespace request",
+			nsAnnotations:   map[string]string{injectorRequestsCPUKey: "50m", injectorLimitsCPUKey: "100m"},
+			podAnnotations:  map[string]string{injectorLimitsCPUKey: "20m"},
+			wantImage:       "example.com/token-injector:v1",
+			wantPullPolicy:  corev1.PullIfNotPresent,
+			wantLimitsCPU:   "100m",
+			wantRegion:      "us-east-1",
+			wantSessionName: "token-injector-webhook-0000000000000000",
+			wantWarnings:    1,
+		},
+		{
+			name:            "namespace region of another partition",
+			nsAnnotations:   map[string]string{namespaceRegionKey: "eu-west-1"},
+			saAnnotations:   map[string]string{awsRoleArnKey: "arn:aws-cn:iam::123456789012:role/testrole"},
+			wantImage:       "example.com/token-injector:v1",
+			wantPullPolicy:  corev1.PullIfNotPresent,
+			wantLimitsCPU:   limitsCPU,
+			wantRegion:      "cn-north-1",
+			wantSessionName: "token-injector-webhook-0000000000000000",
+		},
+		{
+			name: "invalid namespace annotations",
+			nsAnnotations: map[string]string{
+				namespacePullPolicyKey:          "Sometimes",
+				injectorLimitsCPUKey:            "lots",
+				namespaceSessionNameTemplateKey: "{{.Cluster}}",
+			},
+			wantImage:       "example.com/token-injector:v1",
+			wantPullPolicy:  corev1.PullIfNotPresent,
+			wantLimitsCPU:   limitsCPU,
+			wantRegion:      "us-east-1",
+			wantSessionName: "token-injector-webhook-0000000000000000",
+			wantWarnings:    3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saAnnotations := map[string]string{awsRoleArnKey: testRoleArn}
+			for k, v := range tt.saAnnotations {
+				saAnnotations[k] = v
+			}
+			sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+				Name: "test-sa", Namespace: "test-namespace", Annotations: saAnnotations,
+			}}
+			ns := testNamespace("test-namespace")
+			ns.Annotations = tt.nsAnnotations
+			mw := &mutatingWebhook{
+				k8sClient:     fake.NewSimpleClientset(sa, ns),
+				image:         "example.com/token-injector:v1",
+				pullPolicy:    string(corev1.PullIfNotPresent),
+				volumeName:    tokenVolumeName,
+				volumePath:    tokenVolumePath,
+				tokenFile:     tokenFileName,
+				defaultRegion: "us-east-1",
+			}
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Labels: enabledLabels(), Annotations: tt.podAnnotations},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: "test-sa",
+					Containers:         []corev1.Container{{Name: "app"}},
+				},
+			}
+			warnings, err := mw.mutatePod(context.TODO(), pod, "test-namespace", false)
+			if err != nil {
+				t.Fatalf("mutatingWebhook.mutatePod() unexpected error = %v", err)
+			}
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("mutatingWebhook.mutatePod() warnings = %v, want %d", warnings, tt.wantWarnings)
+			}
+			for _, c := range append(pod.Spec.InitContainers, pod.Spec.Containers[1:]...) {
+				if c.Image != tt.wantImage || c.ImagePullPolicy != tt.wantPullPolicy {
+					t.Errorf("container %q image = %q %q, want %q %q", c.Name, c.Image, c.ImagePullPolicy,
+						tt.wantImage, tt.wantPullPolicy)
+				}
+				if got := c.Resources.Limits[corev1.ResourceCPU]; got.Cmp(resource.MustParse(tt.wantLimitsCPU)) != 0 {
+					t.Errorf("container %q CPU limit = %s, want %s", c.Name, got.String(), tt.wantLimitsCPU)
+				}
+			}
+			if got := pod.Annotations[injectorImageKey]; got != tt.wantImage {
+				t.Errorf("injector image annotation = %q, want %q", got, tt.wantImage)
+			}
+			env := map[string]string{}
+			for _, v := range pod.Spec.Containers[0].Env {
+				env[v.Name] = v.Value
+			}
+			if env[awsRegion] != tt.wantRegion {
+				t.Errorf("%s = %q, want %q", awsRegion, env[awsRegion], tt.wantRegion)
+			}
+			if env[awsRoleSessionName] != tt.wantSessionName {
+				t.Errorf("%s = %q, want %q", awsRoleSessionName, env[awsRoleSessionName], tt.wantSessionName)
+			}
+		})
+	}
+}
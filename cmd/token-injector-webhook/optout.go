@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// pod label opting the pod in to the injection; must be set to "true"
+	enabledLabelKey = "admission.token-injector/enabled"
+
+	// annotation opting Pods, ServiceAccounts and Namespaces in ("true") or out ("false") of the injection
+	injectKey = "token-injector.io/inject"
+
+	// annotation recording why the pod was not injected
+	skipReasonKey = "token-injector.io/skip-reason"
+
+	// injection outcome for skipped pods
+	injectionStatusSkipped = "skipped"
+
+	// skip reasons
+	skipReasonLabelDisabled        = "label-disabled"
+	skipReasonPodOptOut            = "pod-opt-out"
+	skipReasonServiceAccountOptOut = "serviceaccount-opt-out"
+	skipReasonNamespaceOptOut      = "namespace-opt-out"
+	skipReasonNoRoleArn            = "no-role-arn"
+	skipReasonNoContainersSelected = "no-containers-selected"
+)
+
+// labelEnabled reports whether the pod opt-in label is set to a true value.
+func labelEnabled(pod *corev1.Pod) bool {
+	enabled, err := strconv.ParseBool(pod.GetLabels()[enabledLabelKey])
+	return err == nil && enabled
+}
+
+// injectAnnotation returns the value of the inject annotation and whether it is set to a valid boolean.
+func injectAnnotation(annotations map[string]string) (inject, ok bool) {
+	value, found := annotations[injectKey]
+	if !found {
+		return false, false
+	}
+	inject, err := strconv.ParseBool(value)
+	if err != nil {
+		logger.WithField("value", value).Warnf("ignoring invalid %s annotation", injectKey)
+		return false, false
+	}
+	return inject, true
+}
+
+// podSkipReason evaluates the opt-in label and the pod inject annotation.
+// It returns the reason to skip the pod, and whether the decision was made at the pod level.
+func podSkipReason(pod *corev1.Pod) (reason string, decided bool) {
+	if !labelEnabled(pod) {
+		return skipReasonLabelDisabled, true
+	}
+	if inject, ok := injectAnnotation(pod.GetAnnotations()); ok {
+		return reasonUnless(inject, skipReasonPodOptOut), true
+	}
+	return "", false
+}
+
+// scopeSkipReason evaluates the inject annotation of the ServiceAccount, then of the Namespace,
+// and returns the reason to skip the pod, or an empty string if the pod must be injected.
+// The Namespace is only looked up when the ServiceAccount does not decide.
+func scopeSkipReason(sa *corev1.ServiceAccount, getNamespace namespaceGetter) (string, error) {
+	if inject, ok := injectAnnotation(sa.GetAnnotations()); ok {
+		return reasonUnless(inject, skipReasonServiceAccountOptOut), nil
+	}
+	namespace, err := getNamespace()
+	if err != nil {
+		return "", err
+	}
+	if inject, ok := injectAnnotation(namespace.GetAnnotations()); ok {
+		return reasonUnless(inject, skipReasonNamespaceOptOut), nil
+	}
+	return "", nil
+}
+
+// reasonUnless returns the skip reason, unless the injection is enabled.
+func reasonUnless(inject bool, reason string) string {
+	if inject {
+		return ""
+	}
+	return reason
+}
+
+// skipPod records the skip reason on the pod.
+func skipPod(pod *corev1.Pod, reason string) {
+	logger.WithFields(log.Fields{
+		"pod":          pod.GetName(),
+		"generateName": pod.GetGenerateName(),
+		"reason":       reason,
+	}).Debug("skipping pod injection")
+	setAnnotation(pod, injectionStatusKey, injectionStatusSkipped)
+	setAnnotation(pod, skipReasonKey, reason)
+	auditSkip(pod)
+}
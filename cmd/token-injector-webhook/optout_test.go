@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+//nolint:funlen
+func Test_mutatingWebhook_mutatePod_optOut(t *testing.T) {
+	tests := []struct {
+		name       string
+		labels     map[string]string
+		podInject  string
+		saInject   string
+		nsInject   string
+		noRoleArn  bool
+		wantReason string
+	}{
+		{
+			name:   "injected by default",
+			labels: enabledLabels(),
+		},
+		{
+			name:       "label set to false",
+			labels:     map[string]string{enabledLabelKey: "false"},
+			wantReason: skipReasonLabelDisabled,
+		},
+		{
+			name:       "label missing",
+			wantReason: skipReasonLabelDisabled,
+		},
+		{
+			name:       "label disabled wins over pod opt-in",
+			labels:     map[string]string{enabledLabelKey: "false"},
+			podInject:  "true",
+			wantReason: skipReasonLabelDisabled,
+		},
+		{
+			name:       "pod opt-out",
+			labels:     enabledLabels(),
+			podInject:  "false",
+			wantReason: skipReasonPodOptOut,
+		},
+		{
+			name:      "pod opt-in wins over namespace opt-out",
+			labels:    enabledLabels(),
+			podInject: "true",
+			nsInject:  "false",
+		},
+		{
+			name:       "service account opt-out",
+			labels:     enabledLabels(),
+			saInject:   "false",
+			wantReason: skipReasonServiceAccountOptOut,
+		},
+		{
+			name:     "service account opt-in wins over namespace opt-out",
+			labels:   enabledLabels(),
+			saInject: "true",
+			nsInject: "false",
+		},
+		{
+			name:       "namespace opt-out",
+			labels:     enabledLabels(),
+			nsInject:   "false",
+			wantReason: skipReasonNamespaceOptOut,
+		},
+		{
+			name:       "invalid annotation value is ignored",
+			labels:     enabledLabels(),
+			podInject:  "nope",
+			nsInject:   "false",
+			wantReason: skipReasonNamespaceOptOut,
+		},
+		{
+			name:       "service account without role arn",
+			labels:     enabledLabels(),
+			noRoleArn:  true,
+			wantReason: skipReasonNoRoleArn,
+		},
+	}
+	annotate := func(annotations map[string]string, value string) map[string]string {
+		if value != "" {
+			annotations[injectKey] = value
+		}
+		return annotations
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saAnnotations := map[string]string{awsRoleArnKey: testRoleArn}
+			if tt.noRoleArn {
+				saAnnotations = map[string]string{}
+			}
+			sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+				Name: "test-sa", Namespace: "test-namespace", Annotations: annotate(saAnnotations, tt.saInject),
+			}}
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name: "test-namespace", Annotations: annotate(map[string]string{}, tt.nsInject),
+			}}
+			mw := &mutatingWebhook{
+				k8sClient:  fake.NewSimpleClientset(sa, ns),
+				volumeName: tokenVolumeName,
+				volumePath: tokenVolumePath,
+				tokenFile:  tokenFileName,
+			}
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Labels: tt.labels, Annotations: annotate(map[string]string{}, tt.podInject)},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: "test-sa",
+					Containers:         []corev1.Container{{Name: "app"}},
+				},
+			}
+			if _, err := mw.mutatePod(context.TODO(), pod, "test-namespace", false); err != nil {
+				t.Fatalf("mutatingWebhook.mutatePod() unexpected error = %v", err)
+			}
+			wantStatus := injectionStatusInjected
+			if tt.wantReason != "" {
+				wantStatus = injectionStatusSkipped
+			}
+			if got := pod.Annotations[injectionStatusKey]; got != wantStatus {
+				t.Errorf("injection status = %q, want %q", got, wantStatus)
+			}
+			if got := pod.Annotations[skipReasonKey]; got != tt.wantReason {
+				t.Errorf("skip reason = %q, want %q", got, tt.wantReason)
+			}
+			if injected := len(pod.Spec.Containers) > 1; injected != (tt.wantReason == "") {
+				t.Errorf("pod injected = %v, want %v", injected, tt.wantReason == "")
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// pod annotation overriding the placement of the injected init container
+	initContainerPlacementKey = "token-injector.io/init-container-placement"
+
+	// init container placements
+	placementFirst       = "first"
+	placementLast        = "last"
+	placementAfterPrefix = "after:"
+
+	// GCE metadata server address, excluded from service mesh traffic interception
+	metadataServerCIDR = "169.254.169.254/32"
+)
+
+// validatePlacement validates an init container placement: first, last or after:<container>.
+func validatePlacement(placement string) error {
+	switch {
+	case placement == placementFirst, placement == placementLast:
+		return nil
+	case strings.HasPrefix(placement, placementAfterPrefix) && len(placement) > len(placementAfterPrefix):
+		return nil
+	default:
+		return fmt.Errorf("invalid init container placement %q: must be %q, %q or %q<container>",
+			placement, placementFirst, placementLast, placementAfterPrefix)
+	}
+}
+
+// initContainerPlacement returns the placement of the injected init container: the pod annotation,
+// if valid, or the configured default.
+func (mw *mutatingWebhook) initContainerPlacement(pod *corev1.Pod) (string, []string) {
+	placement := mw.initContainerPlacementDefault
+	if placement == "" {
+		placement = placementFirst
+	}
+	value, ok := pod.GetAnnotations()[initContainerPlacementKey]
+	if !ok {
+		return placement, nil
+	}
+	if err := validatePlacement(value); err != nil {
+		return placement, []string{fmt.Sprintf("token-injector: ignoring %s annotation: %s", initContainerPlacementKey, err)}
+	}
+	return value, nil
+}
+
+// insertInitContainer inserts the injected init container according to the placement. If the container
+// to place it after is missing, it is inserted first and a warning is returned.
+func insertInitContainer(initContainers []corev1.Container, c corev1.Container, placement string) ([]corev1.Container, []string) {
+	switch {
+	case placement == placementLast:
+		return append(initContainers, c), nil
+	case strings.HasPrefix(placement, placementAfterPrefix):
+		name := strings.TrimPrefix(placement, placementAfterPrefix)
+		if i := findContainer(initContainers, name); i >= 0 {
+			return append(initContainers[:i+1], append([]corev1.Container{c}, initContainers[i+1:]...)...), nil
+		}
+		return append([]corev1.Container{c}, initContainers...), []string{fmt.Sprintf(
+			"token-injector: init container %q not found, injecting %q as first init container", name, c.Name)}
+	default:
+		return append([]corev1.Container{c}, initContainers...), nil
+	}
+}
+
+// excludeMetadataServer adds the metadata server address to the comma separated lists of the configured
+// service mesh annotations (e.g. traffic.sidecar.istio.io/excludeOutboundIPRanges), so that the token-injector
+// containers reach it even when the mesh intercepts the pod traffic.
+func (mw *mutatingWebhook) excludeMetadataServer(pod *corev1.Pod) {
+	for _, key := range mw.meshExcludeAnnotations {
+		ranges := parseList(pod.GetAnnotations()[key])
+		if slices.Contains(ranges, metadataServerCIDR) || slices.Contains(ranges, "*") {
+			continue
+		}
+		setAnnotation(pod, key, strings.Join(append(ranges, metadataServerCIDR), ","))
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+//nolint:funlen
+func Test_mutatingWebhook_mutatePod_initContainerPlacement(t *testing.T) {
+	tests := []struct {
+		name         string
+		placement    string
+		annotation   string
+		native       bool
+		want         []string
+		wantWarnings int
+	}{
+		{
+			name: "first by default",
+			want: []string{injectorInitContainerName, "istio-init", "migrate"},
+		},
+		{
+			name:      "last",
+			placement: placementLast,
+			want:      []string{"istio-init", "migrate", injectorInitContainerName},
+		},
+		{
+			name:      "after named container",
+			placement: placementAfterPrefix + "istio-init",
+			want:      []string{"istio-init", injectorInitContainerName, "migrate"},
+		},
+		{
+			name:         "after missing container",
+			placement:    placementAfterPrefix + "linkerd-init",
+			want:         []string{injectorInitContainerName, "istio-init", "migrate"},
+			wantWarnings: 1,
+		},
+		{
+			name:       "pod annotation override",
+			placement:  placementLast,
+			annotation: placementAfterPrefix + "istio-init",
+			want:       []string{"istio-init", injectorInitContainerName, "migrate"},
+		},
+		{
+			name:         "invalid pod annotation",
+			placement:    placementLast,
+			annotation:   "middle",
+			want:         []string{"istio-init", "migrate", injectorInitContainerName},
+			wantWarnings: 1,
+		},
+		{
+			name:      "native sidecar",
+			placement: placementAfterPrefix + "istio-init",
+			native:    true,
+			want:      []string{"istio-init", injectorSidecarContainerName, "migrate"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+				Name: "test-sa", Namespace: "test-namespace", Annotations: map[string]string{awsRoleArnKey: testRoleArn},
+			}}
+			mw := &mutatingWebhook{
+				k8sClient:                     fake.NewSimpleClientset(sa, testNamespace("test-namespace")),
+				volumeName:                    tokenVolumeName,
+				volumePath:                    tokenVolumePath,
+				tokenFile:                     tokenFileName,
+				initContainerPlacementDefault: tt.placement,
+				sidecarMode:                   sidecarModeContainer,
+			}
+			if tt.native {
+				mw.sidecarMode = sidecarModeNative
+			}
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Labels: enabledLabels(), Annotations: map[string]string{}},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: "test-sa",
+					InitContainers:     []corev1.Container{{Name: "istio-init"}, {Name: "migrate"}},
+					Containers:         []corev1.Container{{Name: "app"}},
+				},
+			}
+			if tt.annotation != "" {
+				pod.Annotations[initContainerPlacementKey] = tt.annotation
+			}
+			// the placement is stable across invocations
+			for i := 0; i < 2; i++ {
+				warnings, err := mw.mutatePod(context.TODO(), pod, "test-namespace", false)
+				if err != nil {
+					t.Fatalf("mutatingWebhook.mutatePod() unexpected error = %v", err)
+				}
+				if i == 0 && len(warnings) != tt.wantWarnings {
+					t.Errorf("mutatingWebhook.mutatePod() warnings = %v, want %d", warnings, tt.wantWarnings)
+				}
+				var got []string
+				for _, c := range pod.Spec.InitContainers {
+					got = append(got, c.Name)
+				}
+				if !cmp.Equal(got, tt.want) {
+					t.Errorf("invocation %d: init containers diff %v", i, cmp.Diff(tt.want, got))
+				}
+			}
+		})
+	}
+}
+
+func Test_mutatingWebhook_excludeMetadataServer(t *testing.T) {
+	const istioKey = "traffic.sidecar.istio.io/excludeOutboundIPRanges"
+	tests := []struct {
+		name     string
+		existing map[string]string
+		want     string
+	}{
+		{name: "not annotated", want: metadataServerCIDR},
+		{name: "appended", existing: map[string]string{istioKey: "10.0.0.0/8"}, want: "10.0.0.0/8," + metadataServerCIDR},
+		{name: "already excluded", existing: map[string]string{istioKey: metadataServerCIDR + ",10.0.0.0/8"}, want: metadataServerCIDR + ",10.0.0.0/8"},
+		{name: "everything excluded", existing: map[string]string{istioKey: "*"}, want: "*"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := &mutatingWebhook{meshExcludeAnnotations: []string{istioKey}}
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: tt.existing}}
+			mw.excludeMetadataServer(pod)
+			if got := pod.Annotations[istioKey]; got != tt.want {
+				t.Errorf("annotation = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_validatePlacement(t *testing.T) {
+	for _, p := range []string{placementFirst, placementLast, "after:istio-init"} {
+		if err := validatePlacement(p); err != nil {
+			t.Errorf("validatePlacement(%q) unexpected error = %v", p, err)
+		}
+	}
+	for _, p := range []string{"", "middle", "after:"} {
+		if err := validatePlacement(p); err == nil {
+			t.Errorf("validatePlacement(%q) expected error", p)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ConfigMap key holding the role ARN policy
+	rolePolicyDataKey = "policy.yaml"
+
+	// what to do with a pod whose role ARN is not allowed by the role ARN policy
+	rolePolicyActionDeny = "deny"
+	rolePolicyActionSkip = "skip"
+
+	skipReasonRoleNotAllowed = "role-not-allowed"
+)
+
+// errRolePolicyNotLoaded is returned while no valid role ARN policy has been loaded.
+var errRolePolicyNotLoaded = errors.New("role ARN policy is not loaded")
+
+// rolePolicyRule allows the listed AWS accounts and role names to the namespaces it selects,
+// either by name or by label selector.
+type rolePolicyRule struct {
+	Namespaces        []string `json:"namespaces,omitempty"`
+	NamespaceSelector string   `json:"namespaceSelector,omitempty"`
+	AccountIDs        []string `json:"accountIDs"`
+	RoleNames         []string `json:"roleNames"`
+
+	selector  labels.Selector
+	roleNames []*regexp.Regexp // compiled RoleNames glob patterns
+}
+
+// rolePolicy is the cluster-wide role ARN policy: a role ARN is allowed in a namespace
+// if any rule selecting the namespace allows both its account ID and its role name.
+type rolePolicy struct {
+	Rules []rolePolicyRule `json:"rules"`
+}
+
+// parseRolePolicy parses and validates a YAML (or JSON) role ARN policy.
+func parseRolePolicy(data string) (*rolePolicy, error) {
+	var p rolePolicy
+	if err := yaml.UnmarshalStrict([]byte(data), &p); err != nil {
+		return nil, fmt.Errorf("invalid role ARN policy: %w", err)
+	}
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if len(rule.Namespaces) == 0 && rule.NamespaceSelector == "" {
+			return nil, fmt.Errorf("invalid role ARN policy: rule %d selects no namespace", i)
+		}
+		if rule.NamespaceSelector != "" {
+			s, err := labels.Parse(rule.NamespaceSelector)
+			if err != nil {
+				return nil, fmt.Errorf("invalid role ARN policy: rule %d namespace selector: %w", i, err)
+			}
+			rule.selector = s
+		}
+		for _, pattern := range rule.RoleNames {
+			re, err := compileGlob(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid role ARN policy: rule %d role name %q: %w", i, pattern, err)
+			}
+			rule.roleNames = append(rule.roleNames, re)
+		}
+	}
+	return &p, nil
+}
+
+// selects reports whether the rule applies to the namespace.
+func (r *rolePolicyRule) selects(ns *corev1.Namespace) bool {
+	for _, name := range r.Namespaces {
+		if name == ns.GetName() {
+			return true
+		}
+	}
+	return r.selector != nil && r.selector.Matches(labels.Set(ns.GetLabels()))
+}
+
+// allows reports whether the rule allows the account ID and role name.
+func (r *rolePolicyRule) allows(accountID, roleName string) bool {
+	accountAllowed := false
+	for _, id := range r.AccountIDs {
+		if id == accountID {
+			accountAllowed = true
+			break
+		}
+	}
+	if !accountAllowed {
+		return false
+	}
+	for _, re := range r.roleNames {
+		if re.MatchString(roleName) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowed reports whether the role ARN is allowed in the namespace.
+func (p *rolePolicy) allowed(ns *corev1.Namespace, roleArn *roleARN) bool {
+	for i := range p.Rules {
+		if p.Rules[i].selects(ns) && p.Rules[i].allows(roleArn.AccountID, roleArn.roleName()) {
+			return true
+		}
+	}
+	return false
+}
+
+// rolePolicyWatcher keeps the role ARN policy loaded from a ConfigMap up to date.
+// An invalid update keeps the previous policy; a deleted ConfigMap unloads it.
+type rolePolicyWatcher struct {
+	client          kubernetes.Interface
+	namespace, name string
+	resync          time.Duration
+	denials         *prometheus.CounterVec
+
+	mu     sync.RWMutex
+	policy *rolePolicy
+}
+
+// newRolePolicyWatcher creates a role ARN policy watcher for the ConfigMap referenced as
+// namespace/name, and registers the denial metric with the given registerer.
+func newRolePolicyWatcher(client kubernetes.Interface, ref string, resync time.Duration,
+	reg prometheus.Registerer) (*rolePolicyWatcher, error) {
+	namespace, name, ok := strings.Cut(ref, "/")
+	if !ok || namespace == "" || name == "" {
+		return nil, fmt.Errorf("invalid role policy ConfigMap %q, expected namespace/name", ref)
+	}
+	w := &rolePolicyWatcher{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+		resync:    resync,
+		denials: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "token_injector",
+			Subsystem: "role_policy",
+			Name:      "denials_total",
+			Help:      "Pods whose AWS Role ARN is not allowed by the role ARN policy, by action (deny, skip).",
+		}, []string{"action"}),
+	}
+	if err := reg.Register(w.denials); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// start starts watching the policy ConfigMap; it runs until the stop channel is closed.
+func (w *rolePolicyWatcher) start(stop <-chan struct{}) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(w.client, w.resync,
+		informers.WithNamespace(w.namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.FieldSelector = "metadata.name=" + w.name
+		}))
+	_, err := factory.Core().V1().ConfigMaps().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    w.update,
+		UpdateFunc: func(_, obj interface{}) { w.update(obj) },
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if cm, ok := obj.(*corev1.ConfigMap); ok && cm.Name == w.name {
+				logger.WithField("configmap", w.namespace+"/"+w.name).Warn("role ARN policy ConfigMap deleted, policy unloaded")
+				w.set(nil)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+	factory.Start(stop)
+	return nil
+}
+
+// update loads the policy from the ConfigMap, keeping the previous policy if it is invalid.
+func (w *rolePolicyWatcher) update(obj interface{}) {
+	cm, ok := obj.(*corev1.ConfigMap)
+	if !ok || cm.Name != w.name {
+		return
+	}
+	p, err := parseRolePolicy(cm.Data[rolePolicyDataKey])
+	if err != nil {
+		logger.WithField("configmap", w.namespace+"/"+w.name).WithError(err).Error("error loading role ARN policy, keeping the previous policy")
+		return
+	}
+	logger.WithField("configmap", w.namespace+"/"+w.name).WithField("rules", len(p.Rules)).Info("loaded role ARN policy")
+	w.set(p)
+}
+
+// set replaces the current policy.
+func (w *rolePolicyWatcher) set(p *rolePolicy) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.policy = p
+}
+
+// current returns the current policy, or nil if no policy is loaded.
+func (w *rolePolicyWatcher) current() *rolePolicy {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.policy
+}
+
+// validateRolePolicyAction validates the role-policy-action flag value.
+func validateRolePolicyAction(action string) error {
+	switch action {
+	case rolePolicyActionDeny, rolePolicyActionSkip:
+		return nil
+	default:
+		return fmt.Errorf("invalid role policy action %q: must be %q or %q", action, rolePolicyActionDeny, rolePolicyActionSkip)
+	}
+}
+
+// enforceRolePolicy checks the role ARN against the role ARN policy, if enabled. A role ARN that is
+// not allowed either denies the pod, or skips the injection and returns a warning, depending on the
+// role policy action.
+func (mw *mutatingWebhook) enforceRolePolicy(pod *corev1.Pod, roleArn *roleARN, getNamespace namespaceGetter) (
+	allowed bool, warnings []string, err error) {
+	if mw.rolePolicy == nil {
+		return true, nil, nil
+	}
+	p := mw.rolePolicy.current()
+	if p == nil {
+		return false, nil, errRolePolicyNotLoaded
+	}
+	ns, err := getNamespace()
+	if err != nil {
+		return false, nil, err
+	}
+	if p.allowed(ns, roleArn) {
+		return true, nil, nil
+	}
+	mw.rolePolicy.denials.WithLabelValues(mw.rolePolicyAction).Inc()
+	msg := fmt.Sprintf("role ARN %q is not allowed in namespace %q by the role ARN policy", roleArn.String(), ns.GetName())
+	if mw.rolePolicyAction == rolePolicyActionDeny {
+		return false, nil, &admissionDeniedError{reason: "token-injector: pod rejected, " + msg}
+	}
+	skipPod(pod, skipReasonRoleNotAllowed)
+	return false, []string{"token-injector: AWS credentials not injected, " + msg}, nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+const testRolePolicy = `
+rules:
+- namespaces: [test-namespace]
+  accountIDs: ["123456789012"]
+  roleNames: ["test*"]
+- namespaceSelector: team=payments
+  accountIDs: ["210987654321"]
+  roleNames: ["payments/*"]
+`
+
+func Test_parseRolePolicy_invalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":    "rules:\n- namespaces: [a]\n  accounts: [\"1\"]\n",
+		"no namespace":     "rules:\n- accountIDs: [\"1\"]\n",
+		"invalid selector": "rules:\n- namespaceSelector: \"a in (\"\n",
+		"not a rule list":  "rules: yes\n",
+		"invalid yaml":     "rules: [\n",
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseRolePolicy(data); err == nil {
+				t.Errorf("parseRolePolicy() expected error")
+			}
+		})
+	}
+}
+
+func Test_rolePolicy_allowed(t *testing.T) {
+	p, err := parseRolePolicy(testRolePolicy)
+	if err != nil {
+		t.Fatalf("parseRolePolicy() unexpected error = %v", err)
+	}
+	payments := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "billing", Labels: map[string]string{"team": "payments"}}}
+	tests := []struct {
+		name    string
+		ns      *corev1.Namespace
+		roleArn string
+		want    bool
+	}{
+		{"namespace by name", testNamespace("test-namespace"), testRoleArn, true},
+		{"role name not allowed", testNamespace("test-namespace"), "arn:aws:iam::123456789012:role/admin", false},
+		{"account not allowed", testNamespace("test-namespace"), "arn:aws:iam::999999999999:role/testrole", false},
+		{"namespace not selected", testNamespace("other"), testRoleArn, false},
+		{"namespace by selector", payments, "arn:aws:iam::210987654321:role/payments/reader", true},
+		{"other tenant role", payments, testRoleArn, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roleArn, err := parseRoleArn(tt.roleArn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := p.allowed(tt.ns, roleArn); got != tt.want {
+				t.Errorf("rolePolicy.allowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_rolePolicyWatcher(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "role-policy", Namespace: "webhook"},
+		Data:       map[string]string{rolePolicyDataKey: testRolePolicy},
+	}
+	client := fake.NewSimpleClientset(cm)
+	w, err := newRolePolicyWatcher(client, "webhook/role-policy", time.Minute, prometheus.NewRegistry())
+	if err != nil {
+		t.Fatalf("newRolePolicyWatcher() unexpected error = %v", err)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	if err = w.start(stop); err != nil {
+		t.Fatalf("rolePolicyWatcher.start() unexpected error = %v", err)
+	}
+	waitFor := func(cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for the role policy")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitFor(func() bool { return w.current() != nil && len(w.current().Rules) == 2 })
+
+	// an invalid update keeps the previous policy
+	cm.Data[rolePolicyDataKey] = "rules: [\n"
+	if _, err = client.CoreV1().ConfigMaps("webhook").Update(context.TODO(), cm, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	cm.Data[rolePolicyDataKey] = "rules: []\n"
+	if _, err = client.CoreV1().ConfigMaps("webhook").Update(context.TODO(), cm, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(func() bool { return w.current() != nil && len(w.current().Rules) == 0 })
+
+	// a deleted ConfigMap unloads the policy
+	if err = client.CoreV1().ConfigMaps("webhook").Delete(context.TODO(), "role-policy", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(func() bool { return w.current() == nil })
+}
+
+func Test_newRolePolicyWatcher_invalidRef(t *testing.T) {
+	for _, ref := range []string{"role-policy", "/role-policy", "webhook/"} {
+		if _, err := newRolePolicyWatcher(fake.NewSimpleClientset(), ref, time.Minute, prometheus.NewRegistry()); err == nil {
+			t.Errorf("newRolePolicyWatcher(%q) expected error", ref)
+		}
+	}
+}
+
+//nolint:funlen
+func Test_mutatingWebhook_mutatePod_rolePolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		roleArn    string
+		action     string
+		unloaded   bool
+		wantDenied bool
+		wantError  bool
+		wantReason string
+	}{
+		{name: "allowed", roleArn: testRoleArn, action: rolePolicyActionDeny},
+		{name: "denied", roleArn: "arn:aws:iam::123456789012:role/admin", action: rolePolicyActionDeny, wantDenied: true},
+		{
+			name: "skipped", roleArn: "arn:aws:iam::123456789012:role/admin", action: rolePolicyActionSkip,
+			wantReason: skipReasonRoleNotAllowed,
+		},
+		{name: "policy not loaded", roleArn: testRoleArn, action: rolePolicyActionDeny, unloaded: true, wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+				Name: "test-sa", Namespace: "test-namespace", Annotations: map[string]string{awsRoleArnKey: tt.roleArn},
+			}}
+			watcher, err := newRolePolicyWatcher(nil, "webhook/role-policy", time.Minute, prometheus.NewRegistry())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.unloaded {
+				p, err := parseRolePolicy(testRolePolicy)
+				if err != nil {
+					t.Fatal(err)
+				}
+				watcher.set(p)
+			}
+			mw := &mutatingWebhook{
+				k8sClient:        fake.NewSimpleClientset(sa, testNamespace("test-namespace")),
+				volumeName:       tokenVolumeName,
+				volumePath:       tokenVolumePath,
+				tokenFile:        tokenFileName,
+				rolePolicy:       watcher,
+				rolePolicyAction: tt.action,
+			}
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Labels: enabledLabels()},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: "test-sa",
+					Containers:         []corev1.Container{{Name: "app"}},
+				},
+			}
+			warnings, err := mw.mutatePod(context.TODO(), pod, "test-namespace", false)
+			var denied *admissionDeniedError
+			if errors.As(err, &denied) != tt.wantDenied {
+				t.Fatalf("mutatingWebhook.mutatePod() error = %v, wantDenied %v", err, tt.wantDenied)
+			}
+			if (err != nil) != (tt.wantDenied || tt.wantError) {
+				t.Fatalf("mutatingWebhook.mutatePod() error = %v, wantError %v", err, tt.wantError)
+			}
+			if got := pod.Annotations[skipReasonKey]; got != tt.wantReason {
+				t.Errorf("skip reason = %q, want %q", got, tt.wantReason)
+			}
+			if (len(warnings) > 0) != (tt.wantReason != "") {
+				t.Errorf("warnings = %v", warnings)
+			}
+			wantDenials := 0.0
+			if tt.wantDenied || tt.wantReason != "" {
+				wantDenials = 1
+			}
+			if got := testutil.ToFloat64(watcher.denials.WithLabelValues(tt.action)); got != wantDenials {
+				t.Errorf("denials = %v, want %v", got, wantDenials)
+			}
+		})
+	}
+}
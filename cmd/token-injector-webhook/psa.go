@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// Pod Security Admission namespace labels
+	podSecurityEnforceKey = "pod-security.kubernetes.io/enforce"
+	podSecurityWarnKey    = "pod-security.kubernetes.io/warn"
+
+	// Pod Security Standards levels
+	podSecurityBaseline   = "baseline"
+	podSecurityRestricted = "restricted"
+)
+
+// capabilities the baseline Pod Security Standard allows to add
+var baselineCapabilities = []corev1.Capability{
+	"AUDIT_WRITE", "CHOWN", "DAC_OVERRIDE", "FOWNER", "FSETID", "KILL", "MKNOD", "NET_BIND_SERVICE",
+	"SETFCAP", "SETGID", "SETPCAP", "SETUID", "SYS_CHROOT",
+}
+
+// podSecurityViolations returns the container security context fields violating the Pod Security Standard level,
+// taking the pod security context defaults into account. Only the fields set by the webhook on the injected
+// containers are checked.
+func podSecurityViolations(level string, pod *corev1.Pod, c *corev1.Container) []string {
+	if level != podSecurityBaseline && level != podSecurityRestricted {
+		return nil
+	}
+	sc := c.SecurityContext
+	if sc == nil {
+		sc = &corev1.SecurityContext{}
+	}
+	psc := pod.Spec.SecurityContext
+	if psc == nil {
+		psc = &corev1.PodSecurityContext{}
+	}
+	seccomp := sc.SeccompProfile
+	if seccomp == nil {
+		seccomp = psc.SeccompProfile
+	}
+	violations := baselineViolations(sc, seccomp)
+	if level == podSecurityBaseline {
+		return violations
+	}
+	return append(violations, restrictedViolations(sc, psc, seccomp)...)
+}
+
+// baselineViolations returns the container security context fields violating the baseline Pod Security Standard.
+func baselineViolations(sc *corev1.SecurityContext, seccomp *corev1.SeccompProfile) []string {
+	var violations []string
+	if sc.Privileged != nil && *sc.Privileged {
+		violations = append(violations, "privileged")
+	}
+	if sc.Capabilities != nil {
+		for _, capability := range sc.Capabilities.Add {
+			if !slices.Contains(baselineCapabilities, capability) {
+				violations = append(violations, fmt.Sprintf("capability %s added", capability))
+			}
+		}
+	}
+	if seccomp != nil && seccomp.Type == corev1.SeccompProfileTypeUnconfined {
+		violations = append(violations, "seccomp profile Unconfined")
+	}
+	return violations
+}
+
+// restrictedViolations returns the container security context fields violating the restricted Pod Security
+// Standard on top of the baseline one.
+func restrictedViolations(sc *corev1.SecurityContext, psc *corev1.PodSecurityContext, seccomp *corev1.SeccompProfile) []string {
+	var violations []string
+	if sc.AllowPrivilegeEscalation == nil || *sc.AllowPrivilegeEscalation {
+		violations = append(violations, "allowPrivilegeEscalation != false")
+	}
+	violations = append(violations, runAsRootViolations(sc, psc)...)
+	if seccomp == nil {
+		violations = append(violations, "seccomp profile not set")
+	}
+	if sc.Capabilities == nil || !slices.Contains(sc.Capabilities.Drop, "ALL") {
+		violations = append(violations, "capabilities not dropping ALL")
+	}
+	if sc.Capabilities != nil {
+		for _, capability := range sc.Capabilities.Add {
+			if capability != "NET_BIND_SERVICE" && slices.Contains(baselineCapabilities, capability) {
+				violations = append(violations, fmt.Sprintf("capability %s added", capability))
+			}
+		}
+	}
+	return violations
+}
+
+// runAsRootViolations returns the runAsNonRoot and runAsUser fields violating the restricted Pod Security
+// Standard, the container security context overriding the pod one.
+func runAsRootViolations(sc *corev1.SecurityContext, psc *corev1.PodSecurityContext) []string {
+	var violations []string
+	if (sc.RunAsNonRoot == nil && (psc.RunAsNonRoot == nil || !*psc.RunAsNonRoot)) ||
+		(sc.RunAsNonRoot != nil && !*sc.RunAsNonRoot) {
+		violations = append(violations, "runAsNonRoot != true")
+	}
+	if (sc.RunAsUser != nil && *sc.RunAsUser == 0) || (sc.RunAsUser == nil && psc.RunAsUser != nil && *psc.RunAsUser == 0) {
+		violations = append(violations, "runAsUser=0")
+	}
+	return violations
+}
+
+// checkPodSecurity checks the injected containers against the Pod Security Admission levels of the namespace:
+// a violation of the enforced level denies the pod, since it would be rejected anyway, and a violation of the
+// warn level is returned as a warning.
+func checkPodSecurity(ns *corev1.Namespace, pod *corev1.Pod, containers ...*corev1.Container) ([]string, error) {
+	var warnings []string
+	for _, mode := range []string{podSecurityEnforceKey, podSecurityWarnKey} {
+		level := ns.GetLabels()[mode]
+		for _, c := range containers {
+			violations := podSecurityViolations(level, pod, c)
+			if len(violations) == 0 {
+				continue
+			}
+			msg := fmt.Sprintf("injected container %q violates the %q Pod Security Standard of namespace %q: %s",
+				c.Name, level, ns.GetName(), strings.Join(violations, ", "))
+			if mode == podSecurityEnforceKey {
+				return nil, &admissionDeniedError{reason: "token-injector: pod rejected, " + msg}
+			}
+			warnings = append(warnings, "token-injector: "+msg)
+		}
+	}
+	return warnings, nil
+}
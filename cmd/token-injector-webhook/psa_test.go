@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
+)
+
+//nolint:funlen
+func Test_podSecurityViolations(t *testing.T) {
+	restrictedPod := &corev1.Pod{Spec: corev1.PodSpec{SecurityContext: &corev1.PodSecurityContext{
+		RunAsNonRoot:   ptr.To(true),
+		SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+	}}}
+	tests := []struct {
+		name  string
+		level string
+		pod   *corev1.Pod
+		spec  func(s *injectorSpec)
+		want  int
+	}{
+		{name: "default spec is restricted", level: podSecurityRestricted, pod: &corev1.Pod{}},
+		{name: "privileged level", level: "privileged", pod: &corev1.Pod{}, spec: func(s *injectorSpec) { *s = injectorSpec{} }},
+		{
+			name: "root is baseline", level: podSecurityBaseline, pod: &corev1.Pod{},
+			spec: func(s *injectorSpec) { s.runAsNonRoot = false },
+		},
+		{
+			name: "root is not restricted", level: podSecurityRestricted, pod: &corev1.Pod{},
+			spec: func(s *injectorSpec) { s.runAsNonRoot = false },
+			want: 1,
+		},
+		{
+			name: "unconfined is not baseline", level: podSecurityBaseline, pod: &corev1.Pod{},
+			spec: func(s *injectorSpec) { s.seccompProfile = string(corev1.SeccompProfileTypeUnconfined) },
+			want: 1,
+		},
+		{
+			name: "no seccomp and capabilities", level: podSecurityRestricted, pod: &corev1.Pod{},
+			spec: func(s *injectorSpec) { s.seccompProfile, s.dropCapabilities = "", "" },
+			want: 2,
+		},
+		{
+			name: "pod security context defaults", level: podSecurityRestricted, pod: restrictedPod,
+			spec: func(s *injectorSpec) { s.seccompProfile = "" },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := defaultInjectorSpec()
+			if tt.spec != nil {
+				tt.spec(&spec)
+			}
+			c := &corev1.Container{Name: injectorSidecarContainerName, SecurityContext: spec.securityContext()}
+			if got := podSecurityViolations(tt.level, tt.pod, c); len(got) != tt.want {
+				t.Errorf("podSecurityViolations() = %v, want %d violations", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mutatingWebhook_mutatePod_podSecurity(t *testing.T) {
+	tests := []struct {
+		name         string
+		labels       map[string]string
+		wantDenied   bool
+		wantWarnings int
+	}{
+		{name: "not labeled"},
+		{name: "enforce", labels: map[string]string{podSecurityEnforceKey: podSecurityRestricted}, wantDenied: true},
+		{name: "warn", labels: map[string]string{podSecurityWarnKey: podSecurityRestricted}, wantWarnings: 2},
+		{name: "enforce baseline", labels: map[string]string{podSecurityEnforceKey: podSecurityBaseline}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+				Name: "test-sa", Namespace: "test-namespace", Annotations: map[string]string{awsRoleArnKey: testRoleArn},
+			}}
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "test-namespace", Labels: tt.labels}}
+			mw := &mutatingWebhook{
+				k8sClient:  fake.NewSimpleClientset(sa, ns),
+				volumeName: tokenVolumeName,
+				volumePath: tokenVolumePath,
+				tokenFile:  tokenFileName,
+			}
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      enabledLabels(),
+					Annotations: map[string]string{injectorRunAsNonRootKey: "false"},
+				},
+				Spec: corev1.PodSpec{ServiceAccountName: "test-sa", Containers: []corev1.Container{{Name: "app"}}},
+			}
+			warnings, err := mw.mutatePod(context.TODO(), pod, "test-namespace", false)
+			var denied *admissionDeniedError
+			if errors.As(err, &denied) != tt.wantDenied {
+				t.Fatalf("mutatingWebhook.mutatePod() error = %v, wantDenied %v", err, tt.wantDenied)
+			}
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("mutatingWebhook.mutatePod() warnings = %v, want %d", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// upsertEnvVar sets the environment variable, replacing an existing variable with the same name.
+// If keepExisting is set, an existing variable is left untouched.
+func upsertEnvVar(env []corev1.EnvVar, v corev1.EnvVar, keepExisting bool) []corev1.EnvVar {
+	for i := range env {
+		if env[i].Name == v.Name {
+			if !keepExisting {
+				env[i] = v
+			}
+			return env
+		}
+	}
+	return append(env, v)
+}
+
+// upsertVolumeMount adds the volume mount, replacing an existing mount of the same volume.
+func upsertVolumeMount(mounts []corev1.VolumeMount, m corev1.VolumeMount) []corev1.VolumeMount {
+	for i := range mounts {
+		if mounts[i].Name == m.Name {
+			mounts[i] = m
+			return mounts
+		}
+	}
+	return append(mounts, m)
+}
+
+// upsertVolume adds the volume, replacing an existing volume with the same name.
+func upsertVolume(volumes []corev1.Volume, v corev1.Volume) []corev1.Volume {
+	for i := range volumes {
+		if volumes[i].Name == v.Name {
+			volumes[i] = v
+			return volumes
+		}
+	}
+	return append(volumes, v)
+}
+
+// findContainer returns the index of the container with the given name, or -1 if there is none.
+func findContainer(containers []corev1.Container, name string) int {
+	for i := range containers {
+		if containers[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeContainer removes the named container from the list, if present.
+func removeContainer(containers []corev1.Container, name string) []corev1.Container {
+	if i := findContainer(containers, name); i >= 0 {
+		return append(containers[:i], containers[i+1:]...)
+	}
+	return containers
+}
+
+// isInjectorContainer reports whether the container was injected by the webhook.
+func isInjectorContainer(name string) bool {
+	return name == injectorInitContainerName || name == injectorSidecarContainerName
+}
+
+// isInjected reports whether the pod already carries any of the objects injected by the webhook.
+func (mw *mutatingWebhook) isInjected(pod *corev1.Pod) bool {
+	if findContainer(pod.Spec.InitContainers, injectorInitContainerName) >= 0 ||
+		findContainer(pod.Spec.InitContainers, injectorSidecarContainerName) >= 0 ||
+		findContainer(pod.Spec.Containers, injectorSidecarContainerName) >= 0 {
+		return true
+	}
+	for i := range pod.Spec.Volumes {
+		if pod.Spec.Volumes[i].Name == mw.volumeName {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+
+	cmp "github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func Test_upsertEnvVar(t *testing.T) {
+	tests := []struct {
+		name         string
+		env          []corev1.EnvVar
+		v            corev1.EnvVar
+		keepExisting bool
+		want         []corev1.EnvVar
+	}{
+		{
+			name: "append missing variable",
+			env:  []corev1.EnvVar{{Name: "A", Value: "a"}},
+			v:    corev1.EnvVar{Name: "B", Value: "b"},
+			want: []corev1.EnvVar{{Name: "A", Value: "a"}, {Name: "B", Value: "b"}},
+		},
+		{
+			name: "replace existing variable",
+			env:  []corev1.EnvVar{{Name: "A", Value: "a"}, {Name: "B", Value: "old"}},
+			v:    corev1.EnvVar{Name: "B", Value: "b"},
+			want: []corev1.EnvVar{{Name: "A", Value: "a"}, {Name: "B", Value: "b"}},
+		},
+		{
+			name:         "keep existing variable",
+			env:          []corev1.EnvVar{{Name: "B", Value: "old"}},
+			v:            corev1.EnvVar{Name: "B", Value: "b"},
+			keepExisting: true,
+			want:         []corev1.EnvVar{{Name: "B", Value: "old"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := upsertEnvVar(tt.env, tt.v, tt.keepExisting)
+			if !cmp.Equal(got, tt.want) {
+				t.Errorf("upsertEnvVar() = diff %v", cmp.Diff(got, tt.want))
+			}
+		})
+	}
+}
+
+func Test_upsertVolumeMount(t *testing.T) {
+	mounts := []corev1.VolumeMount{{Name: "data", MountPath: "/data"}, {Name: tokenVolumeName, MountPath: "/old"}}
+	got := upsertVolumeMount(mounts, corev1.VolumeMount{Name: tokenVolumeName, MountPath: tokenVolumePath})
+	want := []corev1.VolumeMount{{Name: "data", MountPath: "/data"}, {Name: tokenVolumeName, MountPath: tokenVolumePath}}
+	if !cmp.Equal(got, want) {
+		t.Errorf("upsertVolumeMount() = diff %v", cmp.Diff(got, want))
+	}
+}
+
+func Test_upsertVolume(t *testing.T) {
+	volumes := []corev1.Volume{{Name: tokenVolumeName}}
+	got := upsertVolume(volumes, getInjectorVolume(tokenVolumeName))
+	want := []corev1.Volume{getInjectorVolume(tokenVolumeName)}
+	if !cmp.Equal(got, want) {
+		t.Errorf("upsertVolume() = diff %v", cmp.Diff(got, want))
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// Service Account annotations selecting the AWS region and the regional STS endpoint
+	awsRegionKey               = "amazonaws.com/region"
+	awsStsRegionalEndpointsKey = "eks.amazonaws.com/sts-regional-endpoints"
+
+	// AWS region and STS endpoint ENV
+	awsRegion                  = "AWS_REGION"
+	awsDefaultRegion           = "AWS_DEFAULT_REGION"
+	awsStsRegionalEndpoints    = "AWS_STS_REGIONAL_ENDPOINTS"
+	awsStsRegionalEndpointsReg = "regional"
+)
+
+// regionEnv returns the AWS region and STS endpoint environment for the role ARN.
+// The region comes from the Service Account annotation, the default region (flag or namespace annotation) or,
+// for the non-standard partitions, the partition default region; a default region of another partition is
+// ignored for the non-standard partitions, whose STS endpoints only serve their own regions. The regional STS endpoint is enabled by the Service Account
+// annotation or the flag, and always for the non-standard partitions, which the global endpoint does not serve.
+func (mw *mutatingWebhook) regionEnv(sa *corev1.ServiceAccount, roleArn *roleARN) []corev1.EnvVar {
+	region := sa.GetAnnotations()[awsRegionKey]
+	if region == "" && (roleArn.partitionRegion() == "" || roleArn.inPartition(mw.defaultRegion)) {
+		region = mw.defaultRegion
+	}
+	if region == "" {
+		region = roleArn.partitionRegion()
+	}
+	regional := mw.stsRegionalEndpoints
+	if value, ok := sa.GetAnnotations()[awsStsRegionalEndpointsKey]; ok {
+		if b, err := strconv.ParseBool(value); err == nil {
+			regional = b
+		} else {
+			logger.WithField("value", value).Warnf("ignoring invalid %s annotation", awsStsRegionalEndpointsKey)
+		}
+	}
+	if roleArn.partitionRegion() != "" {
+		regional = true
+	}
+
+	var env []corev1.EnvVar
+	if region != "" {
+		env = append(env, corev1.EnvVar{Name: awsRegion, Value: region}, corev1.EnvVar{Name: awsDefaultRegion, Value: region})
+	}
+	if regional {
+		env = append(env, corev1.EnvVar{Name: awsStsRegionalEndpoints, Value: awsStsRegionalEndpointsReg})
+	}
+	return env
+}
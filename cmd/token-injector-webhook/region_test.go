@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+//nolint:funlen
+func Test_mutatingWebhook_regionEnv(t *testing.T) {
+	regionEnv := func(region string) []corev1.EnvVar {
+		return []corev1.EnvVar{{Name: awsRegion, Value: region}, {Name: awsDefaultRegion, Value: region}}
+	}
+	regionalEndpoint := corev1.EnvVar{Name: awsStsRegionalEndpoints, Value: awsStsRegionalEndpointsReg}
+	tests := []struct {
+		name          string
+		annotations   map[string]string
+		defaultRegion string
+		regional      bool
+		roleArn       string
+		want          []corev1.EnvVar
+	}{
+		{
+			name:    "no region",
+			roleArn: testRoleArn,
+		},
+		{
+			name:          "flag defaults",
+			defaultRegion: "eu-west-1",
+			regional:      true,
+			roleArn:       testRoleArn,
+			want:          append(regionEnv("eu-west-1"), regionalEndpoint),
+		},
+		{
+			name:          "annotations override flags",
+			annotations:   map[string]string{awsRegionKey: "us-east-2", awsStsRegionalEndpointsKey: "false"},
+			defaultRegion: "eu-west-1",
+			regional:      true,
+			roleArn:       testRoleArn,
+			want:          regionEnv("us-east-2"),
+		},
+		{
+			name:        "regional endpoint annotation",
+			annotations: map[string]string{awsStsRegionalEndpointsKey: "true"},
+			roleArn:     testRoleArn,
+			want:        []corev1.EnvVar{regionalEndpoint},
+		},
+		{
+			name:        "invalid regional endpoint annotation is ignored",
+			annotations: map[string]string{awsStsRegionalEndpointsKey: "yes please"},
+			regional:    true,
+			roleArn:     testRoleArn,
+			want:        []corev1.EnvVar{regionalEndpoint},
+		},
+		{
+			name:        "non-standard partition is always regional",
+			annotations: map[string]string{awsStsRegionalEndpointsKey: "false"},
+			roleArn:     "arn:aws-us-gov:iam::123456789012:role/testrole",
+			want:        append(regionEnv("us-gov-west-1"), regionalEndpoint),
+		},
+		{
+			name:          "default region of another partition is ignored",
+			defaultRegion: "us-east-1",
+			roleArn:       "arn:aws-cn:iam::123456789012:role/testrole",
+			want:          append(regionEnv("cn-north-1"), regionalEndpoint),
+		},
+		{
+			name:          "default region of the partition",
+			defaultRegion: "us-gov-east-1",
+			roleArn:       "arn:aws-us-gov:iam::123456789012:role/testrole",
+			want:          append(regionEnv("us-gov-east-1"), regionalEndpoint),
+		},
+		{
+			name:        "non-standard partition region annotation",
+			annotations: map[string]string{awsRegionKey: "cn-northwest-1"},
+			roleArn:     "arn:aws-cn:iam::123456789012:role/testrole",
+			want:        append(regionEnv("cn-northwest-1"), regionalEndpoint),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := &mutatingWebhook{defaultRegion: tt.defaultRegion, stsRegionalEndpoints: tt.regional}
+			sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			roleArn, err := parseRoleArn(tt.roleArn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := mw.regionEnv(sa, roleArn); !cmp.Equal(got, tt.want) {
+				t.Errorf("mutatingWebhook.regionEnv() diff %v", cmp.Diff(tt.want, got))
+			}
+		})
+	}
+}
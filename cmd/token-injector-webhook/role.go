@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// namespace annotation with the default AWS Role ARN for pods in the namespace
+	namespaceRoleArnKey = "token-injector.io/default-role-arn"
+
+	// namespace annotation with comma separated AWS Role ARN glob patterns pods may override their role with
+	allowedRoleArnsKey = "token-injector.io/allowed-role-arns"
+
+	// role ARN sources
+	roleSourcePod            = "pod"
+	roleSourceServiceAccount = "serviceaccount"
+	roleSourceNamespace      = "namespace"
+)
+
+// namespaceGetter returns the pod namespace; it is looked up lazily, at most once per admission request.
+type namespaceGetter func() (*corev1.Namespace, error)
+
+// compileGlob compiles the glob pattern, where '*' matches any sequence of characters (including '/')
+// and '?' matches any single character, into an anchored regular expression.
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.ReplaceAll(expr, `\*`, ".*")
+	expr = strings.ReplaceAll(expr, `\?`, ".")
+	return regexp.Compile("^" + expr + "$")
+}
+
+// globMatch reports whether the value matches the glob pattern (see compileGlob).
+func globMatch(pattern, value string) bool {
+	re, err := compileGlob(pattern)
+	return err == nil && re.MatchString(value)
+}
+
+// roleArnAllowed reports whether the role ARN matches one of the comma separated glob patterns.
+func roleArnAllowed(patterns, roleArn string) bool {
+	for _, pattern := range strings.Split(patterns, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" && globMatch(pattern, roleArn) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveRoleArn resolves the AWS Role ARN to inject and its source, in order from:
+// 1. the pod annotation, permitted only if it matches the namespace allowlist;
+// 2. the ServiceAccount annotation;
+// 3. the namespace default annotation.
+// It returns an empty role ARN when none is set, and an admission denial for a pod override
+// that is not permitted by the namespace.
+func resolveRoleArn(pod *corev1.Pod, sa *corev1.ServiceAccount, getNamespace namespaceGetter) (roleArn, source string, err error) {
+	if roleArn, ok := pod.GetAnnotations()[awsRoleArnKey]; ok {
+		ns, err := getNamespace()
+		if err != nil {
+			return "", "", err
+		}
+		if !roleArnAllowed(ns.GetAnnotations()[allowedRoleArnsKey], roleArn) {
+			return "", "", &admissionDeniedError{reason: fmt.Sprintf(
+				"token-injector: pod rejected, role ARN %q from pod annotation %s is not permitted by namespace %q annotation %s",
+				roleArn, awsRoleArnKey, ns.GetName(), allowedRoleArnsKey)}
+		}
+		return roleArn, roleSourcePod, nil
+	}
+	if roleArn, ok := sa.GetAnnotations()[awsRoleArnKey]; ok {
+		return roleArn, roleSourceServiceAccount, nil
+	}
+	ns, err := getNamespace()
+	if err != nil {
+		return "", "", err
+	}
+	if roleArn, ok := ns.GetAnnotations()[namespaceRoleArnKey]; ok {
+		return roleArn, roleSourceNamespace, nil
+	}
+	return "", "", nil
+}
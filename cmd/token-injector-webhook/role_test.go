@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_globMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		want    bool
+	}{
+		{"arn:aws:iam::123456789012:role/app-*", "arn:aws:iam::123456789012:role/app-reader", true},
+		{"arn:aws:iam::123456789012:role/*", "arn:aws:iam::123456789012:role/path/app", true},
+		{"arn:aws:iam::123456789012:role/app-?", "arn:aws:iam::123456789012:role/app-1", true},
+		{"arn:aws:iam::123456789012:role/app-?", "arn:aws:iam::123456789012:role/app-10", false},
+		{"arn:aws:iam::123456789012:role/app", "arn:aws:iam::123456789012:role/app-reader", false},
+		{"arn:aws:iam::*:role/app.reader", "arn:aws:iam::123456789012:role/appXreader", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.value, func(t *testing.T) {
+			if got := globMatch(tt.pattern, tt.value); got != tt.want {
+				t.Errorf("globMatch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+//nolint:funlen
+func Test_resolveRoleArn(t *testing.T) {
+	const (
+		podRoleArn = "arn:aws:iam::123456789012:role/app-reader"
+		nsRoleArn  = "arn:aws:iam::123456789012:role/namespace-default"
+	)
+	tests := []struct {
+		name       string
+		pod        map[string]string
+		sa         map[string]string
+		ns         map[string]string
+		wantArn    string
+		wantSource string
+		wantDenied bool
+	}{
+		{
+			name:       "service account",
+			sa:         map[string]string{awsRoleArnKey: testRoleArn},
+			ns:         map[string]string{namespaceRoleArnKey: nsRoleArn},
+			wantArn:    testRoleArn,
+			wantSource: roleSourceServiceAccount,
+		},
+		{
+			name:       "permitted pod override",
+			pod:        map[string]string{awsRoleArnKey: podRoleArn},
+			sa:         map[string]string{awsRoleArnKey: testRoleArn},
+			ns:         map[string]string{allowedRoleArnsKey: "arn:aws:iam::123456789012:role/other, arn:aws:iam::123456789012:role/app-*"},
+			wantArn:    podRoleArn,
+			wantSource: roleSourcePod,
+		},
+		{
+			name:       "pod override not in allowlist",
+			pod:        map[string]string{awsRoleArnKey: podRoleArn},
+			sa:         map[string]string{awsRoleArnKey: testRoleArn},
+			ns:         map[string]string{allowedRoleArnsKey: "arn:aws:iam::123456789012:role/other"},
+			wantDenied: true,
+		},
+		{
+			name:       "pod override without allowlist",
+			pod:        map[string]string{awsRoleArnKey: podRoleArn},
+			sa:         map[string]string{awsRoleArnKey: testRoleArn},
+			wantDenied: true,
+		},
+		{
+			name:       "namespace default",
+			ns:         map[string]string{namespaceRoleArnKey: nsRoleArn},
+			wantArn:    nsRoleArn,
+			wantSource: roleSourceNamespace,
+		},
+		{
+			name: "no role arn",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: tt.pod}}
+			sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Annotations: tt.sa}}
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "test-namespace", Annotations: tt.ns}}
+			getNamespace := func() (*corev1.Namespace, error) { return ns, nil }
+			gotArn, gotSource, err := resolveRoleArn(pod, sa, getNamespace)
+			var denied *admissionDeniedError
+			if errors.As(err, &denied) != tt.wantDenied {
+				t.Fatalf("resolveRoleArn() error = %v, wantDenied %v", err, tt.wantDenied)
+			}
+			if gotArn != tt.wantArn || gotSource != tt.wantSource {
+				t.Errorf("resolveRoleArn() = (%q, %q), want (%q, %q)", gotArn, gotSource, tt.wantArn, tt.wantSource)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// pod annotations selecting the containers (and init containers) to inject; comma separated container names
+	containersKey        = "token-injector.io/containers"
+	excludeContainersKey = "token-injector.io/exclude-containers"
+)
+
+// containerSelector decides which pod containers get the AWS environment and token mount.
+// A nil include set selects all containers; the exclude set always wins.
+type containerSelector struct {
+	include map[string]bool
+	exclude map[string]bool
+}
+
+// parseList parses a comma separated list, ignoring blank items.
+func parseList(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// parseContainerNames parses a comma separated list of container names into a set.
+func parseContainerNames(value string) map[string]bool {
+	names := map[string]bool{}
+	for _, name := range parseList(value) {
+		names[name] = true
+	}
+	return names
+}
+
+// newContainerSelector creates a container selector from the pod annotations.
+// It returns warnings for annotated container names that do not exist in the pod.
+func newContainerSelector(pod *corev1.Pod) (containerSelector, []string) {
+	var sel containerSelector
+	annotations := pod.GetAnnotations()
+	if value, ok := annotations[containersKey]; ok {
+		sel.include = parseContainerNames(value)
+	}
+	if value, ok := annotations[excludeContainersKey]; ok {
+		sel.exclude = parseContainerNames(value)
+	}
+
+	existing := map[string]bool{}
+	for i := range pod.Spec.InitContainers {
+		existing[pod.Spec.InitContainers[i].Name] = true
+	}
+	for i := range pod.Spec.Containers {
+		existing[pod.Spec.Containers[i].Name] = true
+	}
+	var warnings []string
+	for _, key := range []string{containersKey, excludeContainersKey} {
+		for _, name := range parseList(annotations[key]) {
+			if !existing[name] {
+				warnings = append(warnings, fmt.Sprintf("token-injector: container %q listed in %s annotation not found in pod", name, key))
+			}
+		}
+	}
+	return sel, warnings
+}
+
+// selected reports whether the container must be injected.
+func (s containerSelector) selected(name string) bool {
+	if s.exclude[name] {
+		return false
+	}
+	return s.include == nil || s.include[name]
+}
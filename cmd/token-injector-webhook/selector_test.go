@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_containerSelector_selected(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        map[string]bool
+	}{
+		{
+			name: "all containers by default",
+			want: map[string]bool{"app": true, "istio-proxy": true},
+		},
+		{
+			name:        "include list",
+			annotations: map[string]string{containersKey: "app, other"},
+			want:        map[string]bool{"app": true, "istio-proxy": false},
+		},
+		{
+			name:        "exclude list",
+			annotations: map[string]string{excludeContainersKey: "istio-proxy"},
+			want:        map[string]bool{"app": true, "istio-proxy": false},
+		},
+		{
+			name:        "exclude wins over include",
+			annotations: map[string]string{containersKey: "app,istio-proxy", excludeContainersKey: "istio-proxy"},
+			want:        map[string]bool{"app": true, "istio-proxy": false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}, {Name: "istio-proxy"}}},
+			}
+			sel, _ := newContainerSelector(pod)
+			for name, want := range tt.want {
+				if got := sel.selected(name); got != want {
+					t.Errorf("containerSelector.selected(%q) = %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func Test_newContainerSelector_unknownContainer(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{containersKey: "app,missing"}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+	}
+	if _, warnings := newContainerSelector(pod); len(warnings) != 1 {
+		t.Errorf("newContainerSelector() warnings = %v, want one warning", warnings)
+	}
+}
+
+func Test_mutatingWebhook_mutatePod_containerSelection(t *testing.T) {
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test-sa",
+			Namespace:   "test-namespace",
+			Annotations: map[string]string{awsRoleArnKey: testRoleArn},
+		},
+	}
+	mw := &mutatingWebhook{
+		k8sClient:  fake.NewSimpleClientset(sa, testNamespace("test-namespace")),
+		volumeName: tokenVolumeName,
+		volumePath: tokenVolumePath,
+		tokenFile:  tokenFileName,
+	}
+
+	t.Run("only selected containers are mutated", func(t *testing.T) {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels:      enabledLabels(),
+				Annotations: map[string]string{excludeContainersKey: "istio-proxy,istio-init"},
+			},
+			Spec: corev1.PodSpec{
+				ServiceAccountName: "test-sa",
+				InitContainers:     []corev1.Container{{Name: "istio-init"}},
+				Containers:         []corev1.Container{{Name: "app"}, {Name: "istio-proxy"}},
+			},
+		}
+		if _, err := mw.mutatePod(context.TODO(), pod, "test-namespace", false); err != nil {
+			t.Fatalf("mutatingWebhook.mutatePod() unexpected error = %v", err)
+		}
+		if len(pod.Spec.Containers[0].Env) == 0 {
+			t.Errorf("selected container %q was not mutated", pod.Spec.Containers[0].Name)
+		}
+		if len(pod.Spec.Containers[1].Env) != 0 || len(pod.Spec.InitContainers[1].Env) != 0 {
+			t.Errorf("excluded containers were mutated")
+		}
+		if findContainer(pod.Spec.InitContainers, injectorInitContainerName) < 0 ||
+			findContainer(pod.Spec.Containers, injectorSidecarContainerName) < 0 {
+			t.Errorf("token-injector containers were not injected")
+		}
+	})
+
+	t.Run("no selected containers", func(t *testing.T) {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels:      enabledLabels(),
+				Annotations: map[string]string{containersKey: "missing"},
+			},
+			Spec: corev1.PodSpec{
+				ServiceAccountName: "test-sa",
+				Containers:         []corev1.Container{{Name: "app"}},
+			},
+		}
+		warnings, err := mw.mutatePod(context.TODO(), pod, "test-namespace", false)
+		if err != nil {
+			t.Fatalf("mutatingWebhook.mutatePod() unexpected error = %v", err)
+		}
+		if len(pod.Spec.Containers) != 1 || len(pod.Spec.InitContainers) != 0 || len(pod.Spec.Volumes) != 0 {
+			t.Errorf("token-injector containers injected without selected containers: %+v", pod.Spec)
+		}
+		if len(warnings) != 1 {
+			t.Errorf("mutatingWebhook.mutatePod() warnings = %v, want one warning", warnings)
+		}
+	})
+}
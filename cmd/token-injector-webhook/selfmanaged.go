@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// self-managed TLS Secret keys, besides tls.crt and tls.key
+	caCertKey         = "ca.crt"
+	caKeyKey          = "ca.key"
+	caPreviousCertKey = "ca-previous.crt"
+
+	// validity of the self-managed CA and default validity of the serving certificate
+	selfManagedCAValidity      = 10 * 365 * 24 * time.Hour
+	defaultSelfManagedValidity = 365 * 24 * time.Hour
+
+	// interval between checks of the self-managed certificates
+	selfManagedCheckInterval = time.Minute
+	// time the certificates are backdated by, to tolerate clock skew
+	selfManagedBackdate = time.Hour
+	// time the renewed CA is kept in the caBundle for, until all the replicas serve certificates signed by the new CA
+	selfManagedCARotationGrace = 10 * selfManagedCheckInterval
+	// attempts to store the certificates while the Secret is changed concurrently by other replicas
+	selfManagedConflictRetries = 3
+)
+
+// errTLSSecretConflict is returned when the TLS Secret was changed concurrently by another replica.
+var errTLSSecretConflict = errors.New("TLS Secret changed concurrently")
+
+// selfManagedTLS generates the webhook CA and serving certificate, stores them in a Secret shared by the
+// webhook replicas, and publishes the CA as caBundle of the MutatingWebhookConfiguration. Certificates are
+// renewed once two thirds of their validity have elapsed; a renewed CA stays in the caBundle for
+// selfManagedCARotationGrace, while the replicas switch to certificates signed by the new CA.
+type selfManagedTLS struct {
+	client            kubernetes.Interface
+	namespace, name   string
+	webhookConfigName string
+	dnsNames          []string
+	validity          time.Duration
+	reloader          *certReloader
+	now               func() time.Time
+}
+
+// newSelfManagedTLS creates a self-managed TLS manager storing the certificates in the Secret referenced as
+// namespace/name; the serving certificate is valid for the DNS names and set on the reloader.
+func newSelfManagedTLS(client kubernetes.Interface, secretRef, webhookConfigName string, dnsNames []string,
+	validity time.Duration, reloader *certReloader) (*selfManagedTLS, error) {
+	namespace, name, ok := strings.Cut(secretRef, "/")
+	if !ok || namespace == "" || name == "" {
+		return nil, fmt.Errorf("invalid TLS Secret %q, expected namespace/name", secretRef)
+	}
+	if len(dnsNames) == 0 {
+		return nil, errors.New("self-managed TLS requires at least one DNS name")
+	}
+	if webhookConfigName == "" {
+		return nil, errors.New("self-managed TLS requires the MutatingWebhookConfiguration name")
+	}
+	return &selfManagedTLS{
+		client:            client,
+		namespace:         namespace,
+		name:              name,
+		webhookConfigName: webhookConfigName,
+		dnsNames:          dnsNames,
+		validity:          validity,
+		reloader:          reloader,
+		now:               time.Now,
+	}, nil
+}
+
+// keyPair is a PEM encoded certificate and private key, with the parsed certificate.
+type keyPair struct {
+	certPEM, keyPEM []byte
+	cert            *x509.Certificate
+	key             *ecdsa.PrivateKey
+}
+
+// parseKeyPair parses a PEM encoded certificate and ECDSA private key.
+func parseKeyPair(certPEM, keyPEM []byte) (*keyPair, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, errors.New("invalid PEM data")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return &keyPair{certPEM: certPEM, keyPEM: keyPEM, cert: cert, key: key}, nil
+}
+
+// generateKeyPair generates a certificate from the template, signed by the CA or self-signed if nil.
+func generateKeyPair(template *x509.Certificate, ca *keyPair) (*keyPair, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	template.SerialNumber = serial
+	parent, signer := template, key
+	if ca != nil {
+		parent, signer = ca.cert, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return parseKeyPair(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+// needsRenewal reports whether two thirds of the certificate validity have elapsed.
+func (s *selfManagedTLS) needsRenewal(cert *x509.Certificate) bool {
+	renewAt := cert.NotBefore.Add(cert.NotAfter.Sub(cert.NotBefore) * 2 / 3)
+	return !s.now().Before(renewAt)
+}
+
+// validServingCert reports whether the serving certificate is signed by the CA, covers the DNS names
+// and does not need renewal.
+func (s *selfManagedTLS) validServingCert(serving, ca *keyPair) bool {
+	if serving.cert.CheckSignatureFrom(ca.cert) != nil || s.needsRenewal(serving.cert) {
+		return false
+	}
+	for _, name := range s.dnsNames {
+		if !slices.Contains(serving.cert.DNSNames, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// ensure makes sure valid certificates are stored in the Secret, published in the webhook configuration
+// and served; it generates or renews them as needed. When another replica changes the Secret concurrently,
+// its certificates are reloaded, up to selfManagedConflictRetries times.
+func (s *selfManagedTLS) ensure(ctx context.Context) error {
+	for attempt := 1; ; attempt++ {
+		err := s.reconcile(ctx)
+		if !errors.Is(err, errTLSSecretConflict) || attempt == selfManagedConflictRetries {
+			return err
+		}
+		logger.Debug("TLS Secret changed concurrently, reloading it")
+	}
+}
+
+// reconcile runs a single ensure attempt.
+func (s *selfManagedTLS) reconcile(ctx context.Context) error {
+	secret, err := s.client.CoreV1().Secrets(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get TLS Secret %s/%s: %w", s.namespace, s.name, err)
+	}
+	exists := err == nil
+	if !exists {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: s.name, Namespace: s.namespace},
+			Type:       corev1.SecretTypeTLS,
+		}
+	}
+	ca, previousCA, caChanged, err := s.ensureCA(secret)
+	if err != nil {
+		return err
+	}
+	serving, servingChanged, err := s.ensureServingCert(secret, ca)
+	if err != nil {
+		return err
+	}
+	if caChanged || servingChanged {
+		if err = s.storeSecret(ctx, secret, exists, ca, serving, previousCA); err != nil {
+			return err
+		}
+	}
+	if err = s.publishCABundle(ctx, append(slices.Clone(ca.certPEM), previousCA...)); err != nil {
+		return err
+	}
+	cert, err := tls.X509KeyPair(serving.certPEM, serving.keyPEM)
+	if err != nil {
+		return err
+	}
+	s.reloader.set(&cert)
+	return nil
+}
+
+// ensureCA returns the CA stored in the Secret, generating it when it is missing, invalid or due for renewal.
+// On renewal, the replaced CA is returned as the previous CA, kept in the CA bundle for the rotation grace
+// period, after which it is dropped. It reports whether the CA or the previous CA changed.
+func (s *selfManagedTLS) ensureCA(secret *corev1.Secret) (ca *keyPair, previousCA []byte, changed bool, err error) {
+	previousCA = secret.Data[caPreviousCertKey]
+	ca, err = parseKeyPair(secret.Data[caCertKey], secret.Data[caKeyKey])
+	if err == nil && ca.cert.IsCA && !s.needsRenewal(ca.cert) {
+		if len(previousCA) > 0 && !s.now().Before(ca.cert.NotBefore.Add(selfManagedBackdate+selfManagedCARotationGrace)) {
+			logger.Info("removed the previous webhook CA from the CA bundle")
+			return ca, nil, true, nil
+		}
+		return ca, previousCA, false, nil
+	}
+	// keep trusting the renewed CA while the replicas still serve certificates it signed
+	previousCA = nil
+	if err == nil && ca.cert.IsCA && s.now().Before(ca.cert.NotAfter) {
+		previousCA = ca.certPEM
+	}
+	now := s.now()
+	ca, err = generateKeyPair(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "token-injector-webhook-ca"},
+		NotBefore:             now.Add(-selfManagedBackdate),
+		NotAfter:              now.Add(selfManagedCAValidity),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}, nil)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to generate CA: %w", err)
+	}
+	logger.Info("generated webhook CA")
+	return ca, previousCA, true, nil
+}
+
+// ensureServingCert returns the serving certificate stored in the Secret, issuing it with the CA when it is
+// missing, not signed by the CA, due for renewal or missing a DNS name. It reports whether it was issued.
+func (s *selfManagedTLS) ensureServingCert(secret *corev1.Secret, ca *keyPair) (*keyPair, bool, error) {
+	serving, err := parseKeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err == nil && s.validServingCert(serving, ca) {
+		return serving, false, nil
+	}
+	now := s.now()
+	serving, err = generateKeyPair(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: s.dnsNames[0]},
+		DNSNames:    s.dnsNames,
+		NotBefore:   now.Add(-selfManagedBackdate),
+		NotAfter:    now.Add(s.validity),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to generate serving certificate: %w", err)
+	}
+	logger.WithField("not after", serving.cert.NotAfter).Info("generated webhook serving certificate")
+	return serving, true, nil
+}
+
+// storeSecret creates or updates the Secret with the CA, the previous CA, if any, and the serving certificate.
+// It returns errTLSSecretConflict when another replica stored its certificates first.
+func (s *selfManagedTLS) storeSecret(ctx context.Context, secret *corev1.Secret, exists bool, ca, serving *keyPair,
+	previousCA []byte) error {
+	secret.Data = map[string][]byte{
+		caCertKey:               ca.certPEM,
+		caKeyKey:                ca.keyPEM,
+		corev1.TLSCertKey:       serving.certPEM,
+		corev1.TLSPrivateKeyKey: serving.keyPEM,
+	}
+	if len(previousCA) > 0 {
+		secret.Data[caPreviousCertKey] = previousCA
+	}
+	var err error
+	if exists {
+		_, err = s.client.CoreV1().Secrets(s.namespace).Update(ctx, secret, metav1.UpdateOptions{})
+	} else {
+		_, err = s.client.CoreV1().Secrets(s.namespace).Create(ctx, secret, metav1.CreateOptions{})
+	}
+	if apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err) {
+		// another replica stored its certificates first, use them
+		return fmt.Errorf("%w: %w", errTLSSecretConflict, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store TLS Secret %s/%s: %w", s.namespace, s.name, err)
+	}
+	return nil
+}
+
+// publishCABundle sets the CA bundle as caBundle of all the webhooks of the MutatingWebhookConfiguration.
+func (s *selfManagedTLS) publishCABundle(ctx context.Context, caPEM []byte) error {
+	config, err := s.client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, s.webhookConfigName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get MutatingWebhookConfiguration %s: %w", s.webhookConfigName, err)
+	}
+	changed := false
+	for i := range config.Webhooks {
+		if !bytes.Equal(config.Webhooks[i].ClientConfig.CABundle, caPEM) {
+			config.Webhooks[i].ClientConfig.CABundle = caPEM
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	if _, err = s.client.AdmissionregistrationV1().MutatingWebhookConfigurations().Update(ctx, config, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update MutatingWebhookConfiguration %s caBundle: %w", s.webhookConfigName, err)
+	}
+	logger.WithField("webhook configuration", s.webhookConfigName).Info("published webhook CA bundle")
+	return nil
+}
+
+// run checks the certificates every interval, until the stop channel is closed.
+func (s *selfManagedTLS) run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := s.ensure(context.Background()); err != nil {
+				logger.WithError(err).Error("error checking self-managed TLS certificates")
+			}
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"testing"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	fake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var testDNSNames = []string{"token-injector-webhook", "token-injector-webhook.kube-system.svc"}
+
+func testWebhookConfig() *admissionregistrationv1.MutatingWebhookConfiguration {
+	return &admissionregistrationv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "token-injector-webhook"},
+		Webhooks:   []admissionregistrationv1.MutatingWebhook{{Name: "pods.token-injector.io"}, {Name: "other.token-injector.io"}},
+	}
+}
+
+func newTestSelfManagedTLS(t *testing.T, client kubernetes.Interface, dnsNames []string) *selfManagedTLS {
+	t.Helper()
+	s, err := newSelfManagedTLS(client, "kube-system/token-injector-webhook-tls", "token-injector-webhook",
+		dnsNames, defaultSelfManagedValidity, &certReloader{})
+	if err != nil {
+		t.Fatalf("newSelfManagedTLS() unexpected error = %v", err)
+	}
+	return s
+}
+
+func getTestTLSSecret(t *testing.T, client kubernetes.Interface) *corev1.Secret {
+	t.Helper()
+	secret, err := client.CoreV1().Secrets("kube-system").Get(context.TODO(), "token-injector-webhook-tls", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get TLS Secret: %v", err)
+	}
+	return secret
+}
+
+//nolint:funlen
+func Test_selfManagedTLS_ensure(t *testing.T) {
+	client := fake.NewSimpleClientset(testWebhookConfig())
+	s := newTestSelfManagedTLS(t, client, testDNSNames)
+	if err := s.ensure(context.TODO()); err != nil {
+		t.Fatalf("selfManagedTLS.ensure() unexpected error = %v", err)
+	}
+	secret := getTestTLSSecret(t, client)
+	for _, key := range []string{caCertKey, caKeyKey, corev1.TLSCertKey, corev1.TLSPrivateKeyKey} {
+		if len(secret.Data[key]) == 0 {
+			t.Errorf("TLS Secret %s is empty", key)
+		}
+	}
+
+	// the CA is published in all the webhooks
+	config, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(context.TODO(), "token-injector-webhook", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, webhook := range config.Webhooks {
+		if !bytes.Equal(webhook.ClientConfig.CABundle, secret.Data[caCertKey]) {
+			t.Errorf("webhook %s caBundle is not the self-managed CA", webhook.Name)
+		}
+	}
+
+	// the served certificate is signed by the CA and valid for the DNS names
+	cert, err := s.reloader.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("certReloader.GetCertificate() unexpected error = %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(secret.Data[caCertKey])
+	for _, name := range testDNSNames {
+		if _, err = leaf.Verify(x509.VerifyOptions{DNSName: name, Roots: roots}); err != nil {
+			t.Errorf("served certificate is not valid for %s: %v", name, err)
+		}
+	}
+
+	// another replica reuses the stored certificates
+	other := newTestSelfManagedTLS(t, client, testDNSNames)
+	if err = other.ensure(context.TODO()); err != nil {
+		t.Fatalf("selfManagedTLS.ensure() unexpected error = %v", err)
+	}
+	if reused := getTestTLSSecret(t, client); !bytes.Equal(reused.Data[corev1.TLSCertKey], secret.Data[corev1.TLSCertKey]) {
+		t.Errorf("selfManagedTLS.ensure() replaced valid certificates")
+	}
+
+	// the serving certificate is renewed, keeping the CA
+	other.now = func() time.Time { return time.Now().Add(defaultSelfManagedValidity * 3 / 4) }
+	if err = other.ensure(context.TODO()); err != nil {
+		t.Fatalf("selfManagedTLS.ensure() unexpected error = %v", err)
+	}
+	renewed := getTestTLSSecret(t, client)
+	if bytes.Equal(renewed.Data[corev1.TLSCertKey], secret.Data[corev1.TLSCertKey]) {
+		t.Errorf("selfManagedTLS.ensure() did not renew the serving certificate")
+	}
+	if !bytes.Equal(renewed.Data[caCertKey], secret.Data[caCertKey]) {
+		t.Errorf("selfManagedTLS.ensure() replaced a valid CA")
+	}
+
+	// a new DNS name reissues the serving certificate
+	names := newTestSelfManagedTLS(t, client, append(testDNSNames, "token-injector-webhook.kube-system.svc.cluster.local"))
+	if err = names.ensure(context.TODO()); err != nil {
+		t.Fatalf("selfManagedTLS.ensure() unexpected error = %v", err)
+	}
+	if reissued := getTestTLSSecret(t, client); bytes.Equal(reissued.Data[corev1.TLSCertKey], renewed.Data[corev1.TLSCertKey]) {
+		t.Errorf("selfManagedTLS.ensure() did not reissue the serving certificate for new DNS names")
+	}
+}
+
+func Test_selfManagedTLS_ensure_caRotation(t *testing.T) {
+	client := fake.NewSimpleClientset(testWebhookConfig())
+	s := newTestSelfManagedTLS(t, client, testDNSNames)
+	if err := s.ensure(context.TODO()); err != nil {
+		t.Fatalf("selfManagedTLS.ensure() unexpected error = %v", err)
+	}
+	oldCA := getTestTLSSecret(t, client).Data[caCertKey]
+	caBundle := func() []byte {
+		t.Helper()
+		config, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(context.TODO(),
+			"token-injector-webhook", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return config.Webhooks[0].ClientConfig.CABundle
+	}
+
+	// the renewed CA is published along with the new one
+	rotatedAt := time.Now().Add(selfManagedCAValidity * 3 / 4)
+	s.now = func() time.Time { return rotatedAt }
+	if err := s.ensure(context.TODO()); err != nil {
+		t.Fatalf("selfManagedTLS.ensure() unexpected error = %v", err)
+	}
+	secret := getTestTLSSecret(t, client)
+	if bytes.Equal(secret.Data[caCertKey], oldCA) || !bytes.Equal(secret.Data[caPreviousCertKey], oldCA) {
+		t.Fatalf("selfManagedTLS.ensure() did not renew the CA keeping the previous one")
+	}
+	if want := append(bytes.Clone(secret.Data[caCertKey]), oldCA...); !bytes.Equal(caBundle(), want) {
+		t.Errorf("caBundle does not hold the new and the previous CA")
+	}
+
+	// the previous CA is kept during the grace period
+	s.now = func() time.Time { return rotatedAt.Add(selfManagedCARotationGrace / 2) }
+	if err := s.ensure(context.TODO()); err != nil {
+		t.Fatalf("selfManagedTLS.ensure() unexpected error = %v", err)
+	}
+	if !bytes.Equal(getTestTLSSecret(t, client).Data[caPreviousCertKey], oldCA) {
+		t.Errorf("selfManagedTLS.ensure() removed the previous CA during the grace period")
+	}
+
+	// and dropped afterwards
+	s.now = func() time.Time { return rotatedAt.Add(selfManagedCARotationGrace) }
+	if err := s.ensure(context.TODO()); err != nil {
+		t.Fatalf("selfManagedTLS.ensure() unexpected error = %v", err)
+	}
+	secret = getTestTLSSecret(t, client)
+	if _, ok := secret.Data[caPreviousCertKey]; ok {
+		t.Errorf("selfManagedTLS.ensure() kept the previous CA after the grace period")
+	}
+	if !bytes.Equal(caBundle(), secret.Data[caCertKey]) {
+		t.Errorf("caBundle is not the new CA only")
+	}
+}
+
+func Test_selfManagedTLS_ensure_conflictRetries(t *testing.T) {
+	client := fake.NewSimpleClientset(testWebhookConfig())
+	creates := 0
+	client.PrependReactor("create", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		creates++
+		return true, nil, apierrors.NewAlreadyExists(corev1.Resource("secrets"), "token-injector-webhook-tls")
+	})
+	s := newTestSelfManagedTLS(t, client, testDNSNames)
+	if err := s.ensure(context.TODO()); !errors.Is(err, errTLSSecretConflict) {
+		t.Errorf("selfManagedTLS.ensure() error = %v, want %v", err, errTLSSecretConflict)
+	}
+	if creates != selfManagedConflictRetries {
+		t.Errorf("selfManagedTLS.ensure() attempts = %d, want %d", creates, selfManagedConflictRetries)
+	}
+}
+
+func Test_selfManagedTLS_ensure_missingWebhookConfig(t *testing.T) {
+	s := newTestSelfManagedTLS(t, fake.NewSimpleClientset(), testDNSNames)
+	if err := s.ensure(context.TODO()); err == nil {
+		t.Errorf("selfManagedTLS.ensure() expected error")
+	}
+}
+
+func Test_newSelfManagedTLS_invalid(t *testing.T) {
+	tests := []struct {
+		name       string
+		secretRef  string
+		configName string
+		dnsNames   []string
+	}{
+		{"secret without namespace", "token-injector-webhook-tls", "token-injector-webhook", testDNSNames},
+		{"secret without name", "kube-system/", "token-injector-webhook", testDNSNames},
+		{"no DNS names", "kube-system/token-injector-webhook-tls", "token-injector-webhook", nil},
+		{"no webhook configuration", "kube-system/token-injector-webhook-tls", "", testDNSNames},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newSelfManagedTLS(fake.NewSimpleClientset(), tt.secretRef, tt.configName, tt.dnsNames,
+				defaultSelfManagedValidity, &certReloader{}); err == nil {
+				t.Errorf("newSelfManagedTLS() expected error")
+			}
+		})
+	}
+}
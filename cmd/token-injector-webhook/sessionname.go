@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// default AWS_ROLE_SESSION_NAME template
+	defaultSessionNameTemplate = "token-injector-webhook-{{.Random}}"
+
+	// STS role session name length limits
+	minSessionNameLength = 2
+	maxSessionNameLength = 64
+
+	// length of the random template variable
+	sessionNameRandomLength = 16
+	// length of the hash template variable, and of the hash suffix of truncated names
+	sessionNameHashLength = 8
+)
+
+var (
+	// characters not allowed by STS in a role session name
+	invalidSessionNameChars = regexp.MustCompile(`[^\w+=,.@-]`)
+
+	// session namer used when no template is configured
+	defaultSessionNamer = &sessionNamer{
+		tmpl: template.Must(template.New("session-name").Option("missingkey=error").Parse(defaultSessionNameTemplate)),
+	}
+)
+
+// sessionNameData holds the variables available to the session name template.
+type sessionNameData struct {
+	Namespace      string
+	Pod            string // pod name, or generateName without trailing '-' if the name is not set yet
+	ServiceAccount string
+	Container      string
+	Random         string // random suffix, the same for all containers of the pod
+	Hash           string // hash of the namespace, pod and service account
+}
+
+// newSessionNameData returns the session name template variables of the pod.
+func newSessionNameData(pod *corev1.Pod, ns, serviceAccount string) sessionNameData {
+	podName := pod.GetName()
+	if podName == "" {
+		podName = strings.TrimSuffix(pod.GetGenerateName(), "-")
+	}
+	return sessionNameData{
+		Namespace:      ns,
+		Pod:            podName,
+		ServiceAccount: serviceAccount,
+		Random:         randomString(sessionNameRandomLength),
+		Hash:           shortHash(ns + "/" + podName + "/" + serviceAccount),
+	}
+}
+
+// shortHash returns the first sessionNameHashLength hex characters of the SHA-256 hash of s.
+func shortHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:sessionNameHashLength]
+}
+
+// sessionNamer renders AWS_ROLE_SESSION_NAME values from a template.
+type sessionNamer struct {
+	tmpl *template.Template
+}
+
+// newSessionNamer parses and validates the session name template.
+func newSessionNamer(text string) (*sessionNamer, error) {
+	tmpl, err := template.New("session-name").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session name template %q: %w", text, err)
+	}
+	n := &sessionNamer{tmpl: tmpl}
+	if _, err = n.name(sessionNameData{
+		Namespace: "namespace", Pod: "pod", ServiceAccount: "sa", Container: "container",
+		Random: strings.Repeat("a", sessionNameRandomLength), Hash: strings.Repeat("0", sessionNameHashLength),
+	}); err != nil {
+		return nil, fmt.Errorf("invalid session name template %q: %w", text, err)
+	}
+	return n, nil
+}
+
+// name renders the session name: characters not allowed by STS are replaced with '-', and names longer than
+// 64 characters are truncated and suffixed with a hash of the full name to keep them distinct.
+func (n *sessionNamer) name(data sessionNameData) (string, error) {
+	var buf bytes.Buffer
+	if err := n.tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	name := invalidSessionNameChars.ReplaceAllString(buf.String(), "-")
+	if len(name) > maxSessionNameLength {
+		name = name[:maxSessionNameLength-sessionNameHashLength-1] + "-" + shortHash(name)
+	}
+	if len(name) < minSessionNameLength {
+		return "", fmt.Errorf("session name %q is shorter than %d characters", name, minSessionNameLength)
+	}
+	return name, nil
+}
+
+// sessionName renders the session name of a container with the configured, or default, session namer.
+func (mw *mutatingWebhook) sessionName(data sessionNameData, container string) (string, error) {
+	n := mw.sessionNamer
+	if n == nil {
+		n = defaultSessionNamer
+	}
+	data.Container = container
+	return n.name(data)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+//nolint:funlen
+func Test_sessionNamer_name(t *testing.T) {
+	data := sessionNameData{
+		Namespace:      "test-namespace",
+		Pod:            "app-7d4b9",
+		ServiceAccount: "test-sa",
+		Container:      "app",
+		Random:         strings.Repeat("0", sessionNameRandomLength),
+		Hash:           "1a2b3c4d",
+	}
+	long := strings.Repeat("n", 70)
+	tests := []struct {
+		name     string
+		template string
+		data     sessionNameData
+		want     string
+	}{
+		{
+			name:     "default template",
+			template: defaultSessionNameTemplate,
+			data:     data,
+			want:     "token-injector-webhook-0000000000000000",
+		},
+		{
+			name:     "pod variables",
+			template: "{{.Namespace}}.{{.Pod}}.{{.ServiceAccount}}.{{.Container}}-{{.Hash}}",
+			data:     data,
+			want:     "test-namespace.app-7d4b9.test-sa.app-1a2b3c4d",
+		},
+		{
+			name:     "invalid characters replaced",
+			template: "{{.Namespace}}/{{.Pod}} {{.Container}}:x",
+			data:     data,
+			want:     "test-namespace-app-7d4b9-app-x",
+		},
+		{
+			name:     "truncated with hash suffix",
+			template: "{{.Namespace}}",
+			data:     sessionNameData{Namespace: long},
+			want:     long[:maxSessionNameLength-sessionNameHashLength-1] + "-" + shortHash(long),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := newSessionNamer(tt.template)
+			if err != nil {
+				t.Fatalf("newSessionNamer() unexpected error = %v", err)
+			}
+			got, err := n.name(tt.data)
+			if err != nil {
+				t.Fatalf("sessionNamer.name() unexpected error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("sessionNamer.name() = %q, want %q", got, tt.want)
+			}
+			if len(got) > maxSessionNameLength {
+				t.Errorf("sessionNamer.name() length = %d, want <= %d", len(got), maxSessionNameLength)
+			}
+		})
+	}
+}
+
+func Test_newSessionNamer_invalid(t *testing.T) {
+	for _, tmpl := range []string{"{{.Namespace", "{{.Unknown}}", "x", ""} {
+		if _, err := newSessionNamer(tmpl); err == nil {
+			t.Errorf("newSessionNamer(%q) expected error", tmpl)
+		}
+	}
+}
+
+func Test_mutatingWebhook_mutatePod_sessionName(t *testing.T) {
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+		Name: "test-sa", Namespace: "test-namespace", Annotations: map[string]string{awsRoleArnKey: testRoleArn},
+	}}
+	namer, err := newSessionNamer("{{.Namespace}}.{{.Pod}}-{{.Random}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw := &mutatingWebhook{
+		k8sClient:    fake.NewSimpleClientset(sa, testNamespace("test-namespace")),
+		volumeName:   tokenVolumeName,
+		volumePath:   tokenVolumePath,
+		tokenFile:    tokenFileName,
+		sessionNamer: namer,
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "app-7d4b9-", Labels: enabledLabels()},
+		Spec: corev1.PodSpec{
+			ServiceAccountName: "test-sa",
+			InitContainers:     []corev1.Container{{Name: "init"}},
+			Containers:         []corev1.Container{{Name: "app"}, {Name: "other"}},
+		},
+	}
+	if _, err = mw.mutatePod(context.TODO(), pod, "test-namespace", false); err != nil {
+		t.Fatalf("mutatingWebhook.mutatePod() unexpected error = %v", err)
+	}
+	want := "test-namespace.app-7d4b9-" + strings.Repeat("0", sessionNameRandomLength)
+	found := 0
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, c := range containers {
+			if isInjectorContainer(c.Name) {
+				continue
+			}
+			for _, v := range c.Env {
+				if v.Name != awsRoleSessionName {
+					continue
+				}
+				found++
+				if v.Value != want {
+					t.Errorf("container %q session name = %q, want %q", c.Name, v.Value, want)
+				}
+			}
+		}
+	}
+	if found != 3 {
+		t.Errorf("session name injected in %d containers, want 3", found)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// default webhook and metrics servers timeouts
+const (
+	defaultReadTimeout     = 10 * time.Second
+	defaultWriteTimeout    = 30 * time.Second
+	defaultIdleTimeout     = 2 * time.Minute
+	defaultShutdownDrain   = 5 * time.Second
+	defaultShutdownTimeout = 20 * time.Second
+)
+
+// draining is set once the webhook received a termination signal: /healthz then reports not ready, so that
+// the endpoint is removed from the webhook Service before the server stops.
+var draining atomic.Bool
+
+// serverTimeouts are the read, write and idle timeouts of the HTTP servers.
+type serverTimeouts struct {
+	read, write, idle time.Duration
+}
+
+// server creates an HTTP server with the timeouts; the read timeout also applies to the request headers.
+func (t serverTimeouts) server(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: t.read,
+		ReadTimeout:       t.read,
+		WriteTimeout:      t.write,
+		IdleTimeout:       t.idle,
+	}
+}
+
+// serveGracefully runs serve until it fails or a signal is received on the signals channel. On signal, it
+// flips /healthz to not ready, waits for the drain period, then shuts the servers down, waiting at most the
+// shutdown timeout for in-flight requests.
+func serveGracefully(signals <-chan os.Signal, drain, timeout time.Duration, serve func() error,
+	servers ...*http.Server) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- serve()
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-signals:
+		draining.Store(true)
+		logger.WithField("signal", sig).Infof("shutting down, draining for %s", drain)
+	}
+	select {
+	case err := <-errs:
+		return err
+	case <-time.After(drain):
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var err error
+	for _, server := range servers {
+		if server != nil {
+			err = errors.Join(err, server.Shutdown(ctx))
+		}
+	}
+	if serveErr := <-errs; !errors.Is(serveErr, http.ErrServerClosed) {
+		err = errors.Join(err, serveErr)
+	}
+	if err == nil {
+		logger.Info("webhook server stopped")
+	}
+	return err
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+//nolint:funlen
+func Test_serveGracefully(t *testing.T) {
+	t.Cleanup(func() { draining.Store(false) })
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", http.HandlerFunc(healthzHandler))
+	mux.HandleFunc("/pods", func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+	server := serverTimeouts{read: time.Second, write: 5 * time.Second, idle: time.Second}.server(ln.Addr().String(), mux)
+	url := "http://" + ln.Addr().String()
+
+	signals := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- serveGracefully(signals, 200*time.Millisecond, 5*time.Second,
+			func() error { return server.Serve(ln) }, server, nil)
+	}()
+
+	// an in-flight admission review
+	inFlight := make(chan int, 1)
+	go func() {
+		resp, getErr := http.Get(url + "/pods")
+		if getErr != nil {
+			inFlight <- 0
+			return
+		}
+		resp.Body.Close()
+		inFlight <- resp.StatusCode
+	}()
+
+	signals <- syscall.SIGTERM
+	deadline := time.Now().Add(time.Second)
+	for {
+		resp, getErr := http.Get(url + "/healthz")
+		if getErr == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusServiceUnavailable {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("/healthz not reporting not ready while draining")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the server waits for the in-flight request
+	select {
+	case err = <-done:
+		t.Fatalf("serveGracefully() returned with a request in flight: %v", err)
+	case <-time.After(400 * time.Millisecond):
+	}
+	close(release)
+	if status := <-inFlight; status != http.StatusOK {
+		t.Errorf("in-flight request status = %d, want %d", status, http.StatusOK)
+	}
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Errorf("serveGracefully() unexpected error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("serveGracefully() did not return after shutdown")
+	}
+}
+
+func Test_serveGracefully_serveError(t *testing.T) {
+	serveErr := errors.New("address already in use")
+	err := serveGracefully(make(chan os.Signal), time.Second, time.Second, func() error { return serveErr })
+	if !errors.Is(err, serveErr) {
+		t.Errorf("serveGracefully() error = %v, want %v", err, serveErr)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// sidecar modes; decide how the token refresh container is injected
+	sidecarModeContainer = "container" // regular sidecar container, after a one-shot init container
+	sidecarModeNative    = "native"    // native sidecar: an init container with restartPolicy Always
+	sidecarModeJob       = "job"       // native sidecar for pods owned by a Job, regular sidecar container otherwise
+	sidecarModeAuto      = "auto"      // native sidecar if the cluster supports it, regular sidecar container otherwise
+
+	// first Kubernetes minor version with native sidecars enabled by default
+	nativeSidecarsMinMinor = 29
+
+	// native sidecar startup probe settings; the sidecar is started once the token file is written
+	nativeSidecarProbePeriod           = 1
+	nativeSidecarProbeFailureThreshold = 60
+)
+
+// validateSidecarMode validates the sidecar-mode flag value.
+func validateSidecarMode(mode string) error {
+	switch mode {
+	case sidecarModeContainer, sidecarModeNative, sidecarModeJob, sidecarModeAuto:
+		return nil
+	default:
+		return fmt.Errorf("invalid sidecar mode %q: must be %q, %q, %q or %q",
+			mode, sidecarModeContainer, sidecarModeNative, sidecarModeJob, sidecarModeAuto)
+	}
+}
+
+// nativeSidecarsSupported reports whether the cluster version enables native sidecars by default (1.29+).
+func nativeSidecarsSupported(client kubernetes.Interface) (bool, error) {
+	version, err := client.Discovery().ServerVersion()
+	if err != nil {
+		return false, fmt.Errorf("failed to get server version: %w", err)
+	}
+	major, err := strconv.Atoi(strings.TrimSuffix(version.Major, "+"))
+	if err != nil {
+		return false, fmt.Errorf("invalid server major version %q: %w", version.Major, err)
+	}
+	minor, err := strconv.Atoi(strings.TrimSuffix(version.Minor, "+"))
+	if err != nil {
+		return false, fmt.Errorf("invalid server minor version %q: %w", version.Minor, err)
+	}
+	return major > 1 || (major == 1 && minor >= nativeSidecarsMinMinor), nil
+}
+
+// ownedByJob reports whether the pod is controlled by a Job.
+func ownedByJob(pod *corev1.Pod) bool {
+	for _, ref := range pod.GetOwnerReferences() {
+		if ref.Kind == "Job" && strings.HasPrefix(ref.APIVersion, "batch/") && ref.Controller != nil && *ref.Controller {
+			return true
+		}
+	}
+	return false
+}
+
+// useNativeSidecar reports whether the token refresh container is injected as a native sidecar into the pod.
+func (mw *mutatingWebhook) useNativeSidecar(pod *corev1.Pod) bool {
+	switch mw.sidecarMode {
+	case sidecarModeNative:
+		return true
+	case sidecarModeJob:
+		return ownedByJob(pod)
+	case sidecarModeAuto:
+		return mw.nativeSidecars
+	default:
+		return false
+	}
+}
+
+// getNativeSidecarContainer returns the token refresh container as a native sidecar: it is restarted for
+// the lifetime of the pod without blocking its completion, and reported started once the token file is
+// written, so that the following init containers and the containers find it.
+func getNativeSidecarContainer(image, pullPolicy, volumeName, volumePath, tokenFile string,
+	spec injectorSpec) corev1.Container {
+	c := getInjectorContainer(injectorSidecarContainerName, image, pullPolicy, volumeName, volumePath, tokenFile, true, spec)
+	c.RestartPolicy = ptr.To(corev1.ContainerRestartPolicyAlways)
+	c.StartupProbe = &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			Exec: &corev1.ExecAction{
+				Command: []string{"/token-injector", "--check", fmt.Sprintf("--file=%s/%s", volumePath, tokenFile)},
+			},
+		},
+		PeriodSeconds:    nativeSidecarProbePeriod,
+		FailureThreshold: nativeSidecarProbeFailureThreshold,
+	}
+	return c
+}
+
+// injectNativeSidecar injects the native sidecar into the init containers according to the placement,
+// reconciled in place if already present, and removes the containers injected in the regular sidecar mode.
+func injectNativeSidecar(pod *corev1.Pod, sidecar corev1.Container, placement string) []string {
+	pod.Spec.Containers = removeContainer(pod.Spec.Containers, injectorSidecarContainerName)
+	pod.Spec.InitContainers = removeContainer(pod.Spec.InitContainers, injectorInitContainerName)
+	if i := findContainer(pod.Spec.InitContainers, injectorSidecarContainerName); i >= 0 {
+		pod.Spec.InitContainers[i] = sidecar
+		logger.Debug("successfully reconciled pod native sidecar container")
+		return nil
+	}
+	var warnings []string
+	pod.Spec.InitContainers, warnings = insertInitContainer(pod.Spec.InitContainers, sidecar, placement)
+	logger.WithField("placement", placement).Debug("successfully inserted pod native sidecar container into init containers")
+	return warnings
+}
+
+// injectSidecarContainer injects the one-shot init container according to the placement and the regular sidecar
+// container as last container, reconciled in place if already present, and removes the native sidecar.
+func injectSidecarContainer(pod *corev1.Pod, initContainer, sidecar corev1.Container, placement string) []string {
+	var warnings []string
+	pod.Spec.InitContainers = removeContainer(pod.Spec.InitContainers, injectorSidecarContainerName)
+	// token-injector init container, reconciled in place if already present
+	if i := findContainer(pod.Spec.InitContainers, injectorInitContainerName); i >= 0 {
+		pod.Spec.InitContainers[i] = initContainer
+		logger.Debug("successfully reconciled pod init container")
+	} else {
+		pod.Spec.InitContainers, warnings = insertInitContainer(pod.Spec.InitContainers, initContainer, placement)
+		logger.WithField("placement", placement).Debug("successfully inserted pod init container into spec")
+	}
+	// sidekick token-injector update container (as last container), reconciled in place if already present
+	if i := findContainer(pod.Spec.Containers, injectorSidecarContainerName); i >= 0 {
+		pod.Spec.Containers[i] = sidecar
+		logger.Debug("successfully reconciled pod sidecar container")
+	} else {
+		pod.Spec.Containers = append(pod.Spec.Containers, sidecar)
+		logger.Debug("successfully appended pod sidecar container to spec")
+	}
+	return warnings
+}
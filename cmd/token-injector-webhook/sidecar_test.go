@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	fake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
+)
+
+func Test_nativeSidecarsSupported(t *testing.T) {
+	tests := []struct {
+		major, minor string
+		want         bool
+		wantErr      bool
+	}{
+		{major: "1", minor: "28", want: false},
+		{major: "1", minor: "29", want: true},
+		{major: "1", minor: "31+", want: true},
+		{major: "2", minor: "0", want: true},
+		{major: "1", minor: "x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.major+"."+tt.minor, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			client.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{Major: tt.major, Minor: tt.minor}
+			got, err := nativeSidecarsSupported(client)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("nativeSidecarsSupported() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("nativeSidecarsSupported() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mutatingWebhook_useNativeSidecar(t *testing.T) {
+	jobPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{OwnerReferences: []metav1.OwnerReference{
+		{APIVersion: "batch/v1", Kind: "Job", Name: "test-job", Controller: ptr.To(true)},
+	}}}
+	tests := []struct {
+		mode           string
+		nativeSidecars bool
+		pod            *corev1.Pod
+		want           bool
+	}{
+		{mode: sidecarModeContainer, pod: jobPod, want: false},
+		{mode: sidecarModeNative, pod: &corev1.Pod{}, want: true},
+		{mode: sidecarModeJob, pod: jobPod, want: true},
+		{mode: sidecarModeJob, pod: &corev1.Pod{}, want: false},
+		{mode: sidecarModeAuto, nativeSidecars: true, pod: &corev1.Pod{}, want: true},
+		{mode: sidecarModeAuto, pod: jobPod, want: false},
+	}
+	for _, tt := range tests {
+		mw := &mutatingWebhook{sidecarMode: tt.mode, nativeSidecars: tt.nativeSidecars}
+		if got := mw.useNativeSidecar(tt.pod); got != tt.want {
+			t.Errorf("mutatingWebhook.useNativeSidecar() mode %s = %v, want %v", tt.mode, got, tt.want)
+		}
+	}
+}
+
+func Test_mutatingWebhook_mutatePod_nativeSidecar(t *testing.T) {
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+		Name: "test-sa", Namespace: "test-namespace", Annotations: map[string]string{awsRoleArnKey: testRoleArn},
+	}}
+	mw := &mutatingWebhook{
+		k8sClient:   fake.NewSimpleClientset(sa, testNamespace("test-namespace")),
+		volumeName:  tokenVolumeName,
+		volumePath:  tokenVolumePath,
+		tokenFile:   tokenFileName,
+		sidecarMode: sidecarModeNative,
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Labels: enabledLabels()},
+		Spec: corev1.PodSpec{
+			ServiceAccountName: "test-sa",
+			InitContainers:     []corev1.Container{{Name: "migrate"}},
+			Containers:         []corev1.Container{{Name: "app"}},
+		},
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := mw.mutatePod(context.TODO(), pod, "test-namespace", false); err != nil {
+			t.Fatalf("mutatingWebhook.mutatePod() unexpected error = %v", err)
+		}
+		if len(pod.Spec.InitContainers) != 2 || len(pod.Spec.Containers) != 1 {
+			t.Fatalf("invocation %d: init containers %d, containers %d, want 2 and 1",
+				i, len(pod.Spec.InitContainers), len(pod.Spec.Containers))
+		}
+		sidecar := pod.Spec.InitContainers[0]
+		if sidecar.Name != injectorSidecarContainerName || sidecar.RestartPolicy == nil ||
+			*sidecar.RestartPolicy != corev1.ContainerRestartPolicyAlways || sidecar.StartupProbe == nil {
+			t.Errorf("invocation %d: first init container is not the native sidecar: %+v", i, sidecar)
+		}
+	}
+
+	// switching to the regular sidecar mode replaces the native sidecar
+	mw.sidecarMode = sidecarModeContainer
+	if _, err := mw.mutatePod(context.TODO(), pod, "test-namespace", false); err != nil {
+		t.Fatalf("mutatingWebhook.mutatePod() unexpected error = %v", err)
+	}
+	if pod.Spec.InitContainers[0].Name != injectorInitContainerName || len(pod.Spec.InitContainers) != 2 ||
+		pod.Spec.Containers[len(pod.Spec.Containers)-1].Name != injectorSidecarContainerName {
+		t.Errorf("regular sidecar containers not injected: %+v", pod.Spec)
+	}
+}
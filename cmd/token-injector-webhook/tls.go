@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// default interval between checks of the TLS certificate files
+const defaultCertReloadInterval = 10 * time.Second
+
+// certReloader serves the webhook TLS certificate through tls.Config.GetCertificate, so that rotated
+// certificates are picked up without a restart. The certificate is either loaded from files, and reloaded
+// when they change, or set directly (self-managed TLS).
+type certReloader struct {
+	certFile, keyFile string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+}
+
+// newCertReloader creates a certificate reloader for the certificate and key files, and loads them.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload loads the certificate files if they changed since the last load; it reports whether they were loaded.
+func (r *certReloader) reload() (bool, error) {
+	var modTimes [2]time.Time
+	for i, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return false, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	r.mu.RLock()
+	unchanged := r.cert != nil && modTimes == r.modTimes
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert, r.modTimes = &cert, modTimes
+	return true, nil
+}
+
+// watch reloads the certificate files every interval, until the stop channel is closed. A failed reload
+// (e.g. while the files are being rotated) keeps the current certificate.
+func (r *certReloader) watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			reloaded, err := r.reload()
+			if err != nil {
+				logger.WithError(err).Warn("error reloading TLS certificate, keeping the current one")
+			} else if reloaded {
+				logger.WithField("cert file", r.certFile).Info("reloaded TLS certificate")
+			}
+		}
+	}
+}
+
+// set replaces the served certificate.
+func (r *certReloader) set(cert *tls.Certificate) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = cert
+}
+
+// GetCertificate returns the current certificate; it implements tls.Config.GetCertificate.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.cert == nil {
+		return nil, errors.New("no TLS certificate loaded")
+	}
+	return r.cert, nil
+}
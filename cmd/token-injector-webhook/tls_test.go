@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestKeyPair writes a self-signed certificate for the common name to the files, with the modification time.
+func writeTestKeyPair(t *testing.T, certFile, keyFile, commonName string, modTime time.Time) {
+	t.Helper()
+	pair, err := generateKeyPair(&x509.Certificate{
+		Subject:   pkix.Name{CommonName: commonName},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter:  time.Now().Add(time.Hour),
+	}, nil)
+	if err != nil {
+		t.Fatalf("generateKeyPair() unexpected error = %v", err)
+	}
+	for file, data := range map[string][]byte{certFile: pair.certPEM, keyFile: pair.keyPEM} {
+		if err = os.WriteFile(file, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// servedCommonName returns the common name of the certificate served by the reloader.
+func servedCommonName(t *testing.T, r *certReloader) string {
+	t.Helper()
+	cert, err := r.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("certReloader.GetCertificate() unexpected error = %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func Test_certReloader_reload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	modTime := time.Now().Add(-time.Minute)
+	writeTestKeyPair(t, certFile, keyFile, "first", modTime)
+
+	r, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("newCertReloader() unexpected error = %v", err)
+	}
+	if got := servedCommonName(t, r); got != "first" {
+		t.Errorf("served certificate = %q, want %q", got, "first")
+	}
+	// unchanged files are not reloaded
+	if reloaded, err := r.reload(); err != nil || reloaded {
+		t.Errorf("certReloader.reload() = %v, %v, want false, nil", reloaded, err)
+	}
+	// rotated files are reloaded
+	writeTestKeyPair(t, certFile, keyFile, "second", modTime.Add(time.Second))
+	if reloaded, err := r.reload(); err != nil || !reloaded {
+		t.Errorf("certReloader.reload() = %v, %v, want true, nil", reloaded, err)
+	}
+	if got := servedCommonName(t, r); got != "second" {
+		t.Errorf("served certificate = %q, want %q", got, "second")
+	}
+	// invalid files keep the current certificate
+	if err = os.WriteFile(certFile, []byte("invalid"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chtimes(certFile, modTime.Add(2*time.Second), modTime.Add(2*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.reload(); err == nil {
+		t.Errorf("certReloader.reload() expected error")
+	}
+	if got := servedCommonName(t, r); got != "second" {
+		t.Errorf("served certificate = %q, want %q", got, "second")
+	}
+}
+
+func Test_newCertReloader_missingFile(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := newCertReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")); err == nil {
+		t.Errorf("newCertReloader() expected error")
+	}
+}
+
+func Test_certReloader_GetCertificate_noCertificate(t *testing.T) {
+	if _, err := (&certReloader{}).GetCertificate(&tls.ClientHelloInfo{}); err == nil {
+		t.Errorf("certReloader.GetCertificate() expected error")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// default service name reported in the traces
+	defaultTracingServiceName = "token-injector-webhook"
+
+	// span names
+	spanAdmissionReview        = "admission review"
+	spanServiceAccountLookup   = "serviceaccount lookup"
+	spanPolicyEvaluation       = "policy evaluation"
+	spanPatchGeneration        = "patch generation"
+	tracingInstrumentationName = "github.com/ealebed/token-injector/token-injector-webhook"
+
+	// span attributes
+	attrNamespace        = attribute.Key("k8s.namespace.name")
+	attrPodGenerateName  = attribute.Key("token_injector.pod.generate_name")
+	attrOutcome          = attribute.Key("token_injector.outcome")
+	attrRoleArnSource    = attribute.Key("token_injector.role_arn.source")
+	attrServiceAccount   = attribute.Key("k8s.serviceaccount.name")
+	attrMutatedContainer = attribute.Key("token_injector.mutated_containers")
+)
+
+// tracer creates the webhook spans; it is a no-op until a tracer provider is set by newTracerProvider.
+var tracer = otel.Tracer(tracingInstrumentationName)
+
+// newTracerProvider creates a tracer provider exporting the spans with OTLP over HTTP to the endpoint URL
+// (e.g. http://otel-collector:4318), sampling the traces not sampled by the caller with the ratio, and sets it
+// as the global tracer provider, with the W3C trace context propagator.
+func newTracerProvider(ctx context.Context, endpoint, serviceName string, ratio float64) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceName(serviceName),
+		semconv.ServiceVersion(Version),
+	))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider, nil
+}
+
+// traceAdmission starts a server span per admission review, continuing the incoming trace context if any.
+func traceAdmission(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, spanAdmissionReview, trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// endSpan records the error, if any, on the span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
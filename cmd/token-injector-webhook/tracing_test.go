@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	whlogrus "github.com/slok/kubewebhook/v2/pkg/log/logrus"
+	metrics "github.com/slok/kubewebhook/v2/pkg/metrics/prometheus"
+	"github.com/slok/kubewebhook/v2/pkg/webhook/mutating"
+	"go.opentelemetry.io/otel"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracev1 "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+// testCollector is an OTLP/HTTP trace collector stand-in, keeping the received spans.
+type testCollector struct {
+	mu    sync.Mutex
+	spans []*tracev1.Span
+}
+
+func (c *testCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil || r.URL.Path != "/v1/traces" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	req := &collectortrace.ExportTraceServiceRequest{}
+	if err = proto.Unmarshal(body, req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rs := range req.GetResourceSpans() {
+		for _, ss := range rs.GetScopeSpans() {
+			c.spans = append(c.spans, ss.GetSpans()...)
+		}
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	resp, _ := proto.Marshal(&collectortrace.ExportTraceServiceResponse{})
+	_, _ = w.Write(resp)
+}
+
+// spanAttributes returns the string attributes of the span.
+func spanAttributes(span *tracev1.Span) map[string]string {
+	attrs := map[string]string{}
+	for _, kv := range span.GetAttributes() {
+		attrs[kv.GetKey()] = kv.GetValue().GetStringValue()
+	}
+	return attrs
+}
+
+//nolint:funlen
+func Test_traceAdmission(t *testing.T) {
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	collector := &testCollector{}
+	collectorServer := httptest.NewServer(collector)
+	defer collectorServer.Close()
+	provider, err := newTracerProvider(context.TODO(), collectorServer.URL, "test-webhook", 0)
+	if err != nil {
+		t.Fatalf("newTracerProvider() unexpected error = %v", err)
+	}
+
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+		Name: "test-sa", Namespace: "test-namespace", Annotations: map[string]string{awsRoleArnKey: testRoleArn},
+	}}
+	mw := &mutatingWebhook{
+		k8sClient:  fake.NewSimpleClientset(sa, testNamespace("test-namespace")),
+		volumeName: tokenVolumeName,
+		volumePath: tokenVolumePath,
+		tokenFile:  tokenFileName,
+	}
+	recorder, err := metrics.NewRecorder(metrics.RecorderConfig{Registry: prometheus.NewRegistry()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := traceAdmission(handlerFor(mutating.WebhookConfig{
+		ID:      "test",
+		Obj:     &corev1.Pod{},
+		Mutator: mutating.MutatorFunc(mw.podMutator),
+		Logger:  whlogrus.NewLogrus(log.NewEntry(logger)),
+	}, recorder, logger))
+
+	pod := &corev1.Pod{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "app-5d4f8-", Namespace: "test-namespace", Labels: enabledLabels()},
+		Spec:       corev1.PodSpec{ServiceAccountName: "test-sa", Containers: []corev1.Container{{Name: "app"}}},
+	}
+	podJSON, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	review, err := json.Marshal(&admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request: &admissionv1.AdmissionRequest{
+			UID:       "test-uid",
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Resource:  metav1.GroupVersionResource{Version: "v1", Resource: "pods"},
+			Namespace: "test-namespace",
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: podJSON},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the kube-apiserver sampled the trace, overriding the 0 sample ratio
+	const traceID, parentSpanID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	req := httptest.NewRequest(http.MethodPost, "/pods", bytes.NewReader(review))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parentSpanID+"-01")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("admission review status = %d: %s", rr.Code, rr.Body.String())
+	}
+	if err = provider.ForceFlush(context.TODO()); err != nil {
+		t.Fatalf("TracerProvider.ForceFlush() unexpected error = %v", err)
+	}
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	spans := map[string]*tracev1.Span{}
+	for _, span := range collector.spans {
+		spans[span.GetName()] = span
+	}
+	root := spans[spanAdmissionReview]
+	if root == nil {
+		t.Fatalf("no %q span exported, got %d spans", spanAdmissionReview, len(collector.spans))
+	}
+	if got := hex.EncodeToString(root.GetTraceId()); got != traceID {
+		t.Errorf("admission review trace ID = %s, want the incoming %s", got, traceID)
+	}
+	if got := hex.EncodeToString(root.GetParentSpanId()); got != parentSpanID {
+		t.Errorf("admission review parent span ID = %s, want the incoming %s", got, parentSpanID)
+	}
+	wantAttrs := map[string]string{
+		string(attrNamespace):       "test-namespace",
+		string(attrPodGenerateName): "app-5d4f8-",
+		string(attrOutcome):         outcomeInjected,
+	}
+	gotAttrs := spanAttributes(root)
+	for key, want := range wantAttrs {
+		if gotAttrs[key] != want {
+			t.Errorf("admission review attribute %s = %q, want %q", key, gotAttrs[key], want)
+		}
+	}
+	for _, name := range []string{spanServiceAccountLookup, spanPolicyEvaluation, spanPatchGeneration} {
+		span := spans[name]
+		if span == nil {
+			t.Errorf("no %q span exported", name)
+			continue
+		}
+		if !bytes.Equal(span.GetParentSpanId(), root.GetSpanId()) {
+			t.Errorf("%q span is not a child of the admission review span", name)
+		}
+	}
+	if got := spanAttributes(spans[spanPolicyEvaluation])[string(attrRoleArnSource)]; got != roleSourceServiceAccount {
+		t.Errorf("policy evaluation role ARN source = %q, want %q", got, roleSourceServiceAccount)
+	}
+}
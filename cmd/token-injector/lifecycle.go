@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// workloadWatcher detects the end of the pod workload, either by a termination file written by the
+// workload, or, with a shared process namespace, by the exit of all the other containers processes.
+type workloadWatcher struct {
+	// termination file; the workload is finished once it exists (disabled, if empty)
+	terminationFile string
+	// watch the processes of the other containers (requires a shared process namespace)
+	watchProcesses bool
+	// proc filesystem and own PID, overridable in tests
+	procDir string
+	pid     int
+	// watch interval
+	interval time.Duration
+}
+
+// newWorkloadWatcher creates a workload watcher.
+func newWorkloadWatcher(terminationFile string, watchProcesses bool) *workloadWatcher {
+	return &workloadWatcher{
+		terminationFile: terminationFile,
+		watchProcesses:  watchProcesses,
+		procDir:         "/proc",
+		pid:             os.Getpid(),
+		interval:        time.Second,
+	}
+}
+
+// enabled reports whether the watcher has anything to watch.
+func (w *workloadWatcher) enabled() bool {
+	return w.terminationFile != "" || w.watchProcesses
+}
+
+// otherProcesses returns the number of processes other than the pause container (PID 1) and our own.
+func (w *workloadWatcher) otherProcesses() (int, error) {
+	entries, err := os.ReadDir(w.procDir)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, e := range entries {
+		pid, convErr := strconv.Atoi(e.Name())
+		if convErr != nil || !e.IsDir() || pid == 1 || pid == w.pid {
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
+// watch cancels the context once the workload is finished: the termination file exists or, when watching
+// processes, all the other processes seen at least once have exited. It returns when the context is done.
+func (w *workloadWatcher) watch(ctx context.Context, cancel context.CancelFunc) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	seen := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if w.terminationFile != "" {
+			if _, err := os.Stat(w.terminationFile); err == nil {
+				log.Printf("found termination file %s, workload finished\n", w.terminationFile)
+				cancel()
+				return
+			} else if !errors.Is(err, os.ErrNotExist) {
+				log.Printf("failed to check termination file: %s\n", err)
+			}
+		}
+		if w.watchProcesses {
+			count, err := w.otherProcesses()
+			if err != nil {
+				log.Printf("failed to list processes: %s\n", err)
+				continue
+			}
+			if count > 0 {
+				seen = true
+			} else if seen {
+				log.Println("all workload processes exited, workload finished")
+				cancel()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func Test_workloadWatcher_terminationFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "terminated")
+	w := newWorkloadWatcher(file, false)
+	w.interval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		w.watch(ctx, cancel)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if ctx.Err() != nil {
+		t.Fatal("workload watcher canceled before the termination file was written")
+	}
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("workload watcher did not detect the termination file")
+	}
+	if ctx.Err() == nil {
+		t.Error("workload watcher did not cancel the context")
+	}
+}
+
+func Test_workloadWatcher_processes(t *testing.T) {
+	procDir := t.TempDir()
+	mkdir := func(name string) string {
+		dir := filepath.Join(procDir, name)
+		if err := os.Mkdir(dir, 0o700); err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+	// pause container, own process and non-process entries are ignored
+	mkdir("1")
+	mkdir("42")
+	mkdir("self")
+	w := newWorkloadWatcher("", true)
+	w.procDir, w.pid, w.interval = procDir, 42, 10*time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		w.watch(ctx, cancel)
+		close(done)
+	}()
+	// no workload process seen yet: the workload may not have started
+	time.Sleep(50 * time.Millisecond)
+	if ctx.Err() != nil {
+		t.Fatal("workload watcher canceled before any workload process was seen")
+	}
+	workload := mkdir(strconv.Itoa(100))
+	time.Sleep(50 * time.Millisecond)
+	if ctx.Err() != nil {
+		t.Fatal("workload watcher canceled while the workload is running")
+	}
+	if err := os.Remove(workload); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("workload watcher did not detect the workload exit")
+	}
+}
+
+func Test_workloadWatcher_enabled(t *testing.T) {
+	if newWorkloadWatcher("", false).enabled() {
+		t.Error("workloadWatcher.enabled() = true, want false")
+	}
+	if !newWorkloadWatcher("/tmp/terminated", false).enabled() || !newWorkloadWatcher("", true).enabled() {
+		t.Error("workloadWatcher.enabled() = false, want true")
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -78,8 +79,33 @@ func generateIDToken(
 	}
 }
 
+// checkTokenFile returns an error if the ID token file does not exist or is empty.
+func checkTokenFile(file string) error {
+	if file == "" {
+		return errors.New("no ID token file to check")
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("ID token file %s is empty", file)
+	}
+	return nil
+}
+
 func generateIDTokenCmd(c *cli.Context) error {
-	return generateIDToken(handleSignals(), gcp.NewSaInfo(), gcp.NewIDToken(), c.String("file"), c.Bool("refresh"))
+	if c.Bool("check") {
+		return checkTokenFile(c.String("file"))
+	}
+	ctx := handleSignals()
+	if watcher := newWorkloadWatcher(c.String("termination-file"), c.Bool("exit-with-workload")); watcher.enabled() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		go watcher.watch(ctx, cancel)
+	}
+	return generateIDToken(ctx, gcp.NewSaInfo(), gcp.NewIDToken(), c.String("file"), c.Bool("refresh"))
 }
 
 func handleSignals() context.Context {
@@ -112,6 +138,20 @@ func main() {
 				Name:  "file",
 				Usage: "write ID token into file (stdout, if not specified)",
 			},
+			&cli.BoolFlag{
+				Name:  "check",
+				Value: false,
+				Usage: "check that the ID token file exists and is not empty, and exit (e.g. as a startup probe)",
+			},
+			&cli.StringFlag{
+				Name:  "termination-file",
+				Usage: "exit once this file exists, e.g. written by the workload when finished (disabled, if not specified)",
+			},
+			&cli.BoolFlag{
+				Name:  "exit-with-workload",
+				Value: false,
+				Usage: "exit once all the other containers processes have exited (requires a shared process namespace)",
+			},
 		},
 		Name:    "token-injector",
 		Usage:   "generate ID token with current Google Cloud service account",
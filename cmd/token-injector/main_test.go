@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -152,3 +154,32 @@ func Test_generateIDToken(t *testing.T) {
 		})
 	}
 }
+
+func Test_checkTokenFile(t *testing.T) {
+	dir := t.TempDir()
+	token := filepath.Join(dir, "token")
+	empty := filepath.Join(dir, "empty")
+	if err := os.WriteFile(token, []byte("whatever"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(empty, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		file    string
+		wantErr bool
+	}{
+		{name: "token file", file: token},
+		{name: "empty file", file: empty, wantErr: true},
+		{name: "missing file", file: filepath.Join(dir, "missing"), wantErr: true},
+		{name: "no file", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkTokenFile(tt.file); (err != nil) != tt.wantErr {
+				t.Errorf("checkTokenFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}